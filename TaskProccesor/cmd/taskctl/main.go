@@ -0,0 +1,520 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"taskProcessor/config"
+	"taskProcessor/database"
+	"taskProcessor/models"
+	"taskProcessor/repository"
+	"text/tabwriter"
+	"time"
+
+	"github.com/joho/godotenv"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const usage = `taskctl - herramienta de administración de la cola de tareas
+
+Uso:
+  taskctl <comando> [opciones]
+
+Comandos:
+  enqueue       Encola una tarea desde JSON (-file o stdin)
+  list          Lista tareas (-status, -type, -limit)
+  inspect <id>  Muestra el detalle de una tarea
+  retry <id>    Re-encola una tarea dead o cancelada
+  cancel <id>   Cancela una tarea pendiente
+  requeue-dead  Re-encola todas las tareas dead (-type)
+  purge         Elimina tareas terminadas antiguas (-older-than)
+  stats         Muestra estadísticas de la cola
+  pause         Pausa una cola o tipo (-queue o -type, -reason)
+  resume        Reanuda una cola o tipo (-queue o -type)
+  ratelimit     Limita un tipo a -rate tareas/segundo (-type, -burst, -remove)
+  limit         Máximo de tareas pendientes de una cola o tipo (-queue o -type, -max, -remove);
+                sin -queue ni -type lista los límites
+  leaders       Muestra qué proceso es líder de cada componente de mantenimiento
+
+Todos los comandos de lectura aceptan -o table|json.
+`
+
+// app repositorios que usan los comandos
+type app struct {
+	tasks       *repository.TaskRepository
+	pauses      *repository.PauseRepository
+	rateLimits  *repository.RateLimitRepository
+	queueLimits *repository.QueueLimitRepository
+	leases      *repository.LeaseRepository
+}
+
+// command comando de taskctl: recibe los repositorios y los argumentos restantes
+type command func(ctx context.Context, app *app, args []string) error
+
+var commands = map[string]command{
+	"enqueue":      runEnqueue,
+	"list":         runList,
+	"inspect":      runInspect,
+	"retry":        runRetry,
+	"cancel":       runCancel,
+	"requeue-dead": runRequeueDead,
+	"purge":        runPurge,
+	"stats":        runStats,
+	"pause":        runPause,
+	"resume":       runResume,
+	"ratelimit":    runRateLimit,
+	"limit":        runLimit,
+	"leaders":      runLeaders,
+}
+
+func main() {
+	log.SetFlags(0)
+
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	run, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "comando desconocido: %s\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	godotenv.Load()
+	cfg := config.Load()
+
+	mongoDB, err := database.Connect(cfg.MongoURI, cfg.MongoDatabase)
+	if err != nil {
+		log.Fatalf("❌ Error de conexión: %v", err)
+	}
+
+	repos := &app{
+		tasks:       repository.NewTaskRepository(mongoDB.GetCollection("tasks")),
+		pauses:      repository.NewPauseRepository(mongoDB.GetCollection("queue_pauses")),
+		rateLimits:  repository.NewRateLimitRepository(mongoDB.GetCollection("rate_limits")),
+		queueLimits: repository.NewQueueLimitRepository(mongoDB.GetCollection("queue_limits")),
+		leases:      repository.NewLeaseRepository(mongoDB.GetCollection("leader_leases")),
+	}
+
+	err = run(context.Background(), repos, os.Args[2:])
+	mongoDB.Disconnect()
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+}
+
+func runEnqueue(ctx context.Context, app *app, args []string) error {
+	flags := flag.NewFlagSet("enqueue", flag.ExitOnError)
+	file := flags.String("file", "", "archivo JSON con la tarea (por defecto stdin)")
+	output := flags.String("o", "table", "formato de salida: table|json")
+	flags.Parse(args)
+
+	var reader io.Reader = os.Stdin
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return fmt.Errorf("error al abrir %s: %v", *file, err)
+		}
+		defer f.Close()
+		reader = f
+	}
+
+	var req models.TaskRequest
+	if err := json.NewDecoder(reader).Decode(&req); err != nil {
+		return fmt.Errorf("JSON inválido: %v", err)
+	}
+	task, err := req.NewTask()
+	if err != nil {
+		return err
+	}
+	if err := app.tasks.Create(ctx, task); err != nil {
+		return err
+	}
+	return printTasks(*output, []*models.Task{task})
+}
+
+func runList(ctx context.Context, app *app, args []string) error {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	status := flags.String("status", "", "filtrar por estado")
+	taskType := flags.String("type", "", "filtrar por tipo")
+	limit := flags.Int64("limit", 50, "máximo de tareas (0 = sin límite)")
+	output := flags.String("o", "table", "formato de salida: table|json")
+	flags.Parse(args)
+
+	tasks, err := app.tasks.FindByStatusAndType(ctx, *status, *taskType, *limit)
+	if err != nil {
+		return err
+	}
+	return printTasks(*output, tasks)
+}
+
+func runInspect(ctx context.Context, app *app, args []string) error {
+	flags := flag.NewFlagSet("inspect", flag.ExitOnError)
+	output := flags.String("o", "table", "formato de salida: table|json")
+	id, err := parseIDArg(flags, args)
+	if err != nil {
+		return err
+	}
+
+	task, err := app.tasks.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if task == nil {
+		return repository.ErrTaskNotFound
+	}
+
+	if *output == "json" {
+		return printJSON(struct {
+			*models.Task
+			Events []models.TaskEvent `json:"events"`
+		}{task, task.Events})
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "ID:\t%s\n", task.ID.Hex())
+	fmt.Fprintf(w, "Tipo:\t%s\n", task.Type)
+	fmt.Fprintf(w, "Título:\t%s\n", task.Title)
+	fmt.Fprintf(w, "Estado:\t%s\n", task.Status)
+	fmt.Fprintf(w, "Intentos:\t%d/%d\n", task.Attempts, task.MaxAttempts)
+	fmt.Fprintf(w, "Worker:\t%s\n", task.ClaimedBy)
+	if len(task.RequiredTags) > 0 {
+		fmt.Fprintf(w, "Tags requeridas:\t%s\n", strings.Join(task.RequiredTags, ", "))
+	}
+	fmt.Fprintf(w, "Creada:\t%s\n", task.CreatedAt.Format(time.RFC3339))
+	if task.ExpiresAt != nil {
+		fmt.Fprintf(w, "Expira:\t%s\n", task.ExpiresAt.Format(time.RFC3339))
+	}
+	if task.Progress != nil {
+		fmt.Fprintf(w, "Progreso:\t%d%% %s\n", task.Progress.Percent, task.Progress.Message)
+	}
+	if task.Checkpoint != nil {
+		fmt.Fprintf(w, "Checkpoint:\tintento %d, %s: %s\n", task.Checkpoint.Attempt, task.Checkpoint.SavedAt.Format(time.RFC3339), task.Checkpoint.Data)
+	}
+	if task.Result != "" {
+		fmt.Fprintf(w, "Resultado:\t%s\n", task.Result)
+	}
+	if task.LastError != "" {
+		fmt.Fprintf(w, "Último error:\t%s\n", task.LastError)
+	}
+	payload, _ := json.Marshal(task.Payload)
+	fmt.Fprintf(w, "Payload:\t%s\n", payload)
+
+	if len(task.Events) > 0 {
+		fmt.Fprintln(w, "\nFECHA\tEVENTO\tWORKER\tINTENTO\tESTADO\tMENSAJE")
+		for _, event := range task.Events {
+			attempt := "-"
+			if event.Attempt > 0 {
+				attempt = fmt.Sprint(event.Attempt)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", event.At.Format(time.RFC3339), event.Type,
+				orDash(event.WorkerID), attempt, orDash(event.Status), orDash(event.Message))
+		}
+	}
+	return w.Flush()
+}
+
+func runRetry(ctx context.Context, app *app, args []string) error {
+	id, err := parseIDArg(flag.NewFlagSet("retry", flag.ExitOnError), args)
+	if err != nil {
+		return err
+	}
+	if err := app.tasks.Retry(ctx, id); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Tarea %s re-encolada\n", id.Hex())
+	return nil
+}
+
+func runCancel(ctx context.Context, app *app, args []string) error {
+	id, err := parseIDArg(flag.NewFlagSet("cancel", flag.ExitOnError), args)
+	if err != nil {
+		return err
+	}
+	if err := app.tasks.Cancel(ctx, id); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Tarea %s cancelada\n", id.Hex())
+	return nil
+}
+
+func runRequeueDead(ctx context.Context, app *app, args []string) error {
+	flags := flag.NewFlagSet("requeue-dead", flag.ExitOnError)
+	taskType := flags.String("type", "", "solo tareas de este tipo")
+	flags.Parse(args)
+
+	count, err := app.tasks.RequeueDead(ctx, *taskType)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✅ %d tareas re-encoladas\n", count)
+	return nil
+}
+
+func runPurge(ctx context.Context, app *app, args []string) error {
+	flags := flag.NewFlagSet("purge", flag.ExitOnError)
+	olderThan := flags.Duration("older-than", 30*24*time.Hour, "antigüedad mínima de las tareas a eliminar")
+	flags.Parse(args)
+
+	count, err := app.tasks.PurgeOlderThan(ctx, time.Now().Add(-*olderThan))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("🗑️  %d tareas eliminadas\n", count)
+	return nil
+}
+
+func runStats(ctx context.Context, app *app, args []string) error {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	output := flags.String("o", "table", "formato de salida: table|json")
+	flags.Parse(args)
+
+	stats, err := app.tasks.Stats(ctx)
+	if err != nil {
+		return err
+	}
+	if *output == "json" {
+		return printJSON(stats)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "TOTAL\t%d\n\n", stats.Total)
+	fmt.Fprintln(w, "ESTADO\tTAREAS")
+	for _, status := range models.Statuses {
+		fmt.Fprintf(w, "%s\t%d\n", status, stats.ByStatus[status])
+	}
+	fmt.Fprintln(w, "\nTIPO\tTAREAS")
+	for _, taskType := range sortedKeys(stats.ByType) {
+		fmt.Fprintf(w, "%s\t%d\n", taskType, stats.ByType[taskType])
+	}
+	fmt.Fprintln(w, "\nCOLA\tTAREAS")
+	for _, queue := range sortedKeys(stats.ByQueue) {
+		fmt.Fprintf(w, "%s\t%d\n", queue, stats.ByQueue[queue])
+	}
+	if len(stats.Breakers) > 0 {
+		fmt.Fprintln(w, "\nBREAKER\tESTADO\tFALLOS SEGUIDOS")
+		for _, breaker := range stats.Breakers {
+			fmt.Fprintf(w, "%s\t%s\t%d\n", breaker.Type, breaker.State, breaker.ConsecutiveFailures)
+		}
+	}
+	if len(stats.RateLimits) > 0 {
+		fmt.Fprintln(w, "\nRATE LIMIT\tTAREAS/S\tBURST\tDISPONIBLES")
+		now := time.Now()
+		for _, taskType := range sortedKeys(stats.RateLimits) {
+			limit := stats.RateLimits[taskType]
+			fmt.Fprintf(w, "%s\t%g\t%g\t%.1f\n", taskType, limit.Rate, limit.Burst, limit.Available(now))
+		}
+	}
+	if len(stats.Paused) > 0 {
+		fmt.Fprintln(w, "\nPAUSADO\tMOTIVO")
+		for _, pause := range stats.Paused {
+			fmt.Fprintf(w, "%s %s\t%s\n", pause.Kind, pause.Name, orDash(pause.Reason))
+		}
+	}
+	return w.Flush()
+}
+
+func runPause(ctx context.Context, app *app, args []string) error {
+	flags := flag.NewFlagSet("pause", flag.ExitOnError)
+	reason := flags.String("reason", "", "motivo de la pausa")
+	kind, name, err := parsePauseTarget(flags, args)
+	if err != nil {
+		return err
+	}
+
+	if err := app.pauses.Pause(ctx, kind, name, *reason); err != nil {
+		return err
+	}
+	fmt.Printf("⏸️  %s %s pausado\n", kind, name)
+	return nil
+}
+
+func runResume(ctx context.Context, app *app, args []string) error {
+	kind, name, err := parsePauseTarget(flag.NewFlagSet("resume", flag.ExitOnError), args)
+	if err != nil {
+		return err
+	}
+
+	resumed, err := app.pauses.Resume(ctx, kind, name)
+	if err != nil {
+		return err
+	}
+	if !resumed {
+		return fmt.Errorf("%s %s no estaba pausado", kind, name)
+	}
+	fmt.Printf("▶️  %s %s reanudado\n", kind, name)
+	return nil
+}
+
+func runRateLimit(ctx context.Context, app *app, args []string) error {
+	flags := flag.NewFlagSet("ratelimit", flag.ExitOnError)
+	taskType := flags.String("type", "", "tipo de tarea")
+	rate := flags.Float64("rate", 0, "tareas por segundo entre todos los workers")
+	burst := flags.Int("burst", 1, "tareas que se pueden reclamar seguidas")
+	remove := flags.Bool("remove", false, "quitar el límite del tipo")
+	flags.Parse(args)
+
+	if *taskType == "" {
+		return fmt.Errorf("indicar -type")
+	}
+	if *remove {
+		if err := app.rateLimits.RemoveLimit(ctx, *taskType); err != nil {
+			return err
+		}
+		fmt.Printf("🚦 Rate limit de %s eliminado\n", *taskType)
+		return nil
+	}
+
+	if err := app.rateLimits.SetLimit(ctx, *taskType, *rate, *burst); err != nil {
+		return err
+	}
+	fmt.Printf("🚦 %s limitado a %g tareas/s (burst %d)\n", *taskType, *rate, *burst)
+	return nil
+}
+
+func runLimit(ctx context.Context, app *app, args []string) error {
+	flags := flag.NewFlagSet("limit", flag.ExitOnError)
+	queue := flags.String("queue", "", "nombre de la cola")
+	taskType := flags.String("type", "", "tipo de tarea")
+	maxPending := flags.Int64("max", 0, "máximo de tareas pendientes")
+	remove := flags.Bool("remove", false, "quitar el límite")
+	output := flags.String("o", "table", "formato de salida: table|json")
+	flags.Parse(args)
+
+	var kind, name string
+	switch {
+	case *queue == "" && *taskType == "":
+		limits, err := app.queueLimits.List(ctx)
+		if err != nil {
+			return err
+		}
+		if *output == "json" {
+			return printJSON(limits)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "LÍMITE\tNOMBRE\tMÁX. PENDIENTES")
+		for _, limit := range limits {
+			fmt.Fprintf(w, "%s\t%s\t%d\n", limit.Kind, limit.Name, limit.MaxPending)
+		}
+		return w.Flush()
+	case *queue != "" && *taskType == "":
+		kind, name = models.PauseKindQueue, *queue
+	case *taskType != "" && *queue == "":
+		kind, name = models.PauseKindType, *taskType
+	default:
+		return fmt.Errorf("indicar -queue o -type, no los dos")
+	}
+
+	if *remove {
+		removed, err := app.queueLimits.RemoveLimit(ctx, kind, name)
+		if err != nil {
+			return err
+		}
+		if !removed {
+			return fmt.Errorf("%s %s no tenía límite", kind, name)
+		}
+		fmt.Printf("🧱 Límite de %s %s eliminado\n", kind, name)
+		return nil
+	}
+
+	if err := app.queueLimits.SetLimit(ctx, kind, name, *maxPending); err != nil {
+		return err
+	}
+	fmt.Printf("🧱 %s %s limitado a %d tareas pendientes\n", kind, name, *maxPending)
+	return nil
+}
+
+func runLeaders(ctx context.Context, app *app, args []string) error {
+	flags := flag.NewFlagSet("leaders", flag.ExitOnError)
+	output := flags.String("o", "table", "formato de salida: table|json")
+	flags.Parse(args)
+
+	leases, err := app.leases.List(ctx)
+	if err != nil {
+		return err
+	}
+	if *output == "json" {
+		return printJSON(leases)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "COMPONENTE\tLÍDER\tDESDE\tVENCE")
+	for _, lease := range leases {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", lease.Name, lease.Owner,
+			lease.AcquiredAt.Format(time.RFC3339), lease.ExpiresAt.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+// sortedKeys claves de un mapa ordenadas alfabéticamente
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// parsePauseTarget parsea -queue o -type (exactamente uno de los dos)
+func parsePauseTarget(flags *flag.FlagSet, args []string) (kind string, name string, err error) {
+	queue := flags.String("queue", "", "nombre de la cola")
+	taskType := flags.String("type", "", "tipo de tarea")
+	flags.Parse(args)
+
+	switch {
+	case *queue != "" && *taskType == "":
+		return models.PauseKindQueue, *queue, nil
+	case *taskType != "" && *queue == "":
+		return models.PauseKindType, *taskType, nil
+	default:
+		return "", "", fmt.Errorf("indicar -queue o -type")
+	}
+}
+
+// parseIDArg parsea las opciones y espera un único argumento con el ID de la tarea
+func parseIDArg(flags *flag.FlagSet, args []string) (primitive.ObjectID, error) {
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return primitive.NilObjectID, fmt.Errorf("se esperaba el ID de la tarea")
+	}
+	id, err := primitive.ObjectIDFromHex(flags.Arg(0))
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("ID de tarea inválido: %s", flags.Arg(0))
+	}
+	return id, nil
+}
+
+func printTasks(output string, tasks []*models.Task) error {
+	if output == "json" {
+		return printJSON(tasks)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTIPO\tESTADO\tINTENTOS\tWORKER\tCREADA\tTÍTULO")
+	for _, task := range tasks {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d/%d\t%s\t%s\t%s\n",
+			task.ID.Hex(), task.Type, task.Status, task.Attempts, task.MaxAttempts,
+			orDash(task.ClaimedBy), task.CreatedAt.Format("2006-01-02 15:04"), task.Title)
+	}
+	return w.Flush()
+}
+
+func printJSON(value interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+func orDash(value string) string {
+	if strings.TrimSpace(value) == "" {
+		return "-"
+	}
+	return value
+}
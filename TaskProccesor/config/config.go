@@ -3,12 +3,31 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"taskProcessor/models"
 )
 
 type Config struct {
 	MongoURI      string
 	MongoDatabase string
 	ServerPort    string
+	WorkerCount   int
+	WorkerMin     int // Con WorkerMax > 0 el pool escala entre WorkerMin y WorkerMax
+	WorkerMax     int
+	WorkerQueues  []string
+	WorkerTags    []string // Capacidades de este host (ej: has-imagemagick, region:eu)
+	ChangeStreams bool     // Despertar a los workers con change streams (requiere replica set)
+	SMTPHost      string
+	SMTPPort      string
+	SMTPUsername  string
+	SMTPPassword  string
+	SMTPFrom      string
+	OutputDir     string              // Donde los handlers escriben miniaturas y reportes
+	ImageInputDir string              // Único directorio del que process_image lee archivos locales
+	ExecCommands  map[string][]string // Comandos permitidos para el handler "exec"
+	ExecMaxOutput int                 // Bytes máximos de stdout de un comando (0 = el del handler)
+	WebhookSecret string              // Clave HMAC con la que se firman los webhooks
 }
 
 // Cargar congiguración desde variables de entorno
@@ -28,10 +47,105 @@ func Load() *Config {
 		serverPort = "8080"
 	}
 
+	workerCount := 5
+	if value := os.Getenv("WORKER_COUNT"); value != "" {
+		count, err := strconv.Atoi(value)
+		if err != nil || count <= 0 {
+			log.Fatalf("WORKER_COUNT inválido: %s", value)
+		}
+		workerCount = count
+	}
+
+	// WORKER_MIN / WORKER_MAX: autoscaling del pool (WORKER_COUNT es la cantidad inicial)
+	workerMin, workerMax := 0, 0
+	if value := os.Getenv("WORKER_MAX"); value != "" {
+		count, err := strconv.Atoi(value)
+		if err != nil || count <= 0 {
+			log.Fatalf("WORKER_MAX inválido: %s", value)
+		}
+		workerMax = count
+		workerMin = 1
+	}
+	if value := os.Getenv("WORKER_MIN"); value != "" {
+		count, err := strconv.Atoi(value)
+		if err != nil || count <= 0 || (workerMax > 0 && count > workerMax) {
+			log.Fatalf("WORKER_MIN inválido: %s", value)
+		}
+		workerMin = count
+	}
+
+	// WORKER_QUEUES: colas separadas por coma que atiende este proceso (vacío = todas)
+	var workerQueues []string
+	for _, queue := range strings.Split(os.Getenv("WORKER_QUEUES"), ",") {
+		if queue = strings.TrimSpace(queue); queue != "" {
+			workerQueues = append(workerQueues, queue)
+		}
+	}
+
+	// WORKER_TAGS: tags separadas por coma que ofrece este proceso; solo toma
+	// tareas cuyas required_tags estén todas en la lista
+	workerTags := models.NormalizeTags(strings.Split(os.Getenv("WORKER_TAGS"), ","))
+
+	changeStreams := false
+	if value := os.Getenv("CHANGE_STREAMS"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			log.Fatalf("CHANGE_STREAMS inválido: %s", value)
+		}
+		changeStreams = enabled
+	}
+
+	// EXEC_COMMANDS: "nombre=/ruta/al/script arg1 arg2;otro=/ruta/otro"
+	execCommands := map[string][]string{}
+	for _, entry := range strings.Split(os.Getenv("EXEC_COMMANDS"), ";") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, command, ok := strings.Cut(entry, "=")
+		argv := strings.Fields(command)
+		if !ok || strings.TrimSpace(name) == "" || len(argv) == 0 {
+			log.Fatalf("EXEC_COMMANDS inválido: %s", entry)
+		}
+		execCommands[strings.TrimSpace(name)] = argv
+	}
+
+	execMaxOutput := 0
+	if value := os.Getenv("EXEC_MAX_OUTPUT_BYTES"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || size <= 0 {
+			log.Fatalf("EXEC_MAX_OUTPUT_BYTES inválido: %s", value)
+		}
+		execMaxOutput = size
+	}
+
 	return &Config{
 		MongoURI:      mongoUri,
 		MongoDatabase: mongoDataBase,
 		ServerPort:    serverPort,
+		WorkerCount:   workerCount,
+		WorkerMin:     workerMin,
+		WorkerMax:     workerMax,
+		WorkerQueues:  workerQueues,
+		WorkerTags:    workerTags,
+		ChangeStreams: changeStreams,
+		SMTPHost:      getEnv("SMTP_HOST", "localhost"),
+		SMTPPort:      getEnv("SMTP_PORT", "1025"),
+		SMTPUsername:  os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:  os.Getenv("SMTP_PASSWORD"),
+		SMTPFrom:      getEnv("SMTP_FROM", "taskprocessor@localhost"),
+		OutputDir:     getEnv("OUTPUT_DIR", "output"),
+		ImageInputDir: getEnv("IMAGE_INPUT_DIR", "samples"),
+		ExecCommands:  execCommands,
+		ExecMaxOutput: execMaxOutput,
+		WebhookSecret: os.Getenv("WEBHOOK_SECRET"),
 	}
 
 }
+
+// getEnv valor de una variable de entorno o defaultValue si no está definida
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,192 @@
+package events
+
+import (
+	"strconv"
+	"sync"
+	"taskProcessor/models"
+	"time"
+)
+
+// dedupeWindow tiempo durante el que se recuerda un evento ya publicado, para no
+// repetirlo cuando el poller lo lee del historial de la tarea
+const dedupeWindow = 2 * time.Minute
+
+// Eventos que solo se publican en el bus (no quedan en el historial de la tarea)
+const (
+	TypeStarted  = "started"  // El worker empezó a ejecutar el handler
+	TypeProgress = "progress" // El handler reportó progreso
+)
+
+// Event transición de una tarea publicada en el bus
+type Event struct {
+	TaskID   string `json:"task_id"`
+	TaskType string `json:"task_type"`
+	Queue    string `json:"queue"`
+	models.TaskEvent
+}
+
+// key identifica el evento: el mismo evento leído del historial tiene la misma clave
+func (e Event) key() string {
+	return e.TaskID + "|" + e.Type + "|" + strconv.FormatInt(e.At.UnixMilli(), 10)
+}
+
+// Filter restringe los eventos que recibe una suscripción (campos vacíos = todos)
+type Filter struct {
+	TaskID string
+	Type   string
+	Queue  string
+}
+
+// Matches indica si el evento pasa el filtro
+func (f Filter) Matches(event Event) bool {
+	return (f.TaskID == "" || f.TaskID == event.TaskID) &&
+		(f.Type == "" || f.Type == event.TaskType) &&
+		(f.Queue == "" || f.Queue == event.Queue)
+}
+
+// Subscription suscripción al bus. Los eventos llegan por C; si el suscriptor no
+// los consume a tiempo se descartan en vez de frenar al publicador.
+type Subscription struct {
+	C      <-chan Event
+	events chan Event
+	filter Filter
+	local  bool
+	bus    *Bus
+}
+
+// Unsubscribe da de baja la suscripción
+func (s *Subscription) Unsubscribe() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	delete(s.bus.subscribers, s)
+}
+
+// Bus bus de eventos de tareas en memoria del proceso
+type Bus struct {
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+	seen        map[string]time.Time
+	closed      bool
+}
+
+func NewBus() *Bus {
+	return &Bus{
+		subscribers: map[*Subscription]struct{}{},
+		seen:        map[string]time.Time{},
+	}
+}
+
+// Subscribe crea una suscripción con un buffer de buffer eventos
+func (b *Bus) Subscribe(filter Filter, buffer int) *Subscription {
+	return b.subscribe(filter, buffer, false)
+}
+
+// SubscribeLocal igual que Subscribe, para quien solo necesita los eventos de este
+// proceso: no cuenta en HasRemoteSubscribers, así no obliga a hacer polling
+func (b *Bus) SubscribeLocal(filter Filter, buffer int) *Subscription {
+	return b.subscribe(filter, buffer, true)
+}
+
+func (b *Bus) subscribe(filter Filter, buffer int, local bool) *Subscription {
+	events := make(chan Event, buffer)
+	subscription := &Subscription{C: events, events: events, filter: filter, local: local, bus: b}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(events)
+		return subscription
+	}
+	b.subscribers[subscription] = struct{}{}
+	return subscription
+}
+
+// Close cierra el canal de todas las suscripciones (por ejemplo, al apagar el
+// servidor HTTP, para que terminen los streams abiertos)
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for subscription := range b.subscribers {
+		close(subscription.events)
+		delete(b.subscribers, subscription)
+	}
+}
+
+// HasRemoteSubscribers indica si alguien necesita también los eventos de otros procesos
+func (b *Bus) HasRemoteSubscribers() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for subscription := range b.subscribers {
+		if !subscription.local {
+			return true
+		}
+	}
+	return false
+}
+
+// Publish envía el evento a los suscriptores cuyo filtro lo acepta
+func (b *Bus) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remember(event)
+	b.deliver(event)
+}
+
+// PublishIfNew igual que Publish, salvo que el evento ya se haya publicado
+// (por ejemplo, lo generó este mismo proceso y ahora llega por el poller)
+func (b *Bus) PublishIfNew(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, seen := b.seen[event.key()]; seen {
+		return
+	}
+	b.remember(event)
+	b.deliver(event)
+}
+
+func (b *Bus) remember(event Event) {
+	now := time.Now()
+	b.seen[event.key()] = now
+	if len(b.seen) < 10000 {
+		return
+	}
+	for key, at := range b.seen {
+		if now.Sub(at) > dedupeWindow {
+			delete(b.seen, key)
+		}
+	}
+}
+
+func (b *Bus) deliver(event Event) {
+	for subscription := range b.subscribers {
+		if !subscription.filter.Matches(event) {
+			continue
+		}
+		select {
+		case subscription.events <- event:
+		default:
+		}
+	}
+}
+
+// StatusAfter estado en que queda una tarea después de un evento del historial.
+// Los eventos failed guardan su propio estado (pending o dead).
+func StatusAfter(eventType string) string {
+	switch eventType {
+	case models.EventCreated, models.EventRetried:
+		return models.StatusPending
+	case models.EventClaimed, models.EventLeaseExtended, TypeStarted, TypeProgress:
+		return models.StatusRunning
+	case models.EventSucceeded:
+		return models.StatusProcessed
+	case models.EventCancelled:
+		return models.StatusCancelled
+	case models.EventExpired:
+		return models.StatusExpired
+	}
+	return ""
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"taskProcessor/models"
+	"taskProcessor/service"
+	"time"
+)
+
+// SMTPConfig servidor SMTP al que se envían los emails
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string // Vacío = sin autenticación (por ejemplo, un servidor SMTP falso local)
+	Password string
+	From     string
+}
+
+// NewSendEmailHandler handler de "send_email". Payload: email, subject y body (opcional).
+func NewSendEmailHandler(config SMTPConfig) service.Handler {
+	return func(ctx context.Context, task *models.Task) (service.Result, error) {
+		to, err := payloadString(task, "email", true)
+		if err != nil {
+			return service.Result{}, err
+		}
+		address, err := mail.ParseAddress(to)
+		if err != nil {
+			return service.Result{}, service.Permanent(fmt.Errorf("email inválido %q: %v", to, err))
+		}
+		subject, _ := payloadString(task, "subject", false)
+		body, _ := payloadString(task, "body", false)
+
+		// La cabecera To conserva el nombre; RCPT TO solo acepta la dirección
+		if err := sendMail(ctx, config, address.Address, buildMessage(config.From, to, subject, body)); err != nil {
+			return service.Result{}, err
+		}
+		return service.Result{Output: fmt.Sprintf("Email enviado a %s", to)}, nil
+	}
+}
+
+// buildMessage arma el mensaje en texto plano con sus cabeceras
+func buildMessage(from, to, subject, body string) []byte {
+	var message strings.Builder
+	fmt.Fprintf(&message, "From: %s\r\n", from)
+	fmt.Fprintf(&message, "To: %s\r\n", to)
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	message.WriteString("\r\n")
+	message.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return []byte(message.String())
+}
+
+// sendMail envía el mensaje respetando la cancelación del contexto.
+// Usa STARTTLS si el servidor lo ofrece y autenticación solo si hay usuario.
+func sendMail(ctx context.Context, config SMTPConfig, to string, message []byte) error {
+	address := net.JoinHostPort(config.Host, config.Port)
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return fmt.Errorf("error al conectar con el servidor SMTP %s: %v", address, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	// Si el contexto se cancela sin deadline, cerrar la conexión corta la conversación
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	client, err := smtp.NewClient(conn, config.Host)
+	if err != nil {
+		return fmt.Errorf("error al iniciar la sesión SMTP: %v", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: config.Host}); err != nil {
+			return fmt.Errorf("error en STARTTLS: %v", err)
+		}
+	}
+	if config.Username != "" {
+		auth := smtp.PlainAuth("", config.Username, config.Password, config.Host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("error de autenticación SMTP: %v", err)
+		}
+	}
+
+	if err := client.Mail(config.From); err != nil {
+		return smtpError("error en MAIL FROM", err)
+	}
+	if err := client.Rcpt(to); err != nil {
+		return smtpError("error en RCPT TO", err)
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return smtpError("error en DATA", err)
+	}
+	if _, err := writer.Write(message); err != nil {
+		return fmt.Errorf("error al enviar el mensaje: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		return smtpError("error al enviar el mensaje", err)
+	}
+	return client.Quit()
+}
+
+// smtpError envuelve el error de un comando SMTP. Una respuesta 5xx es un
+// rechazo definitivo del servidor (destinatario inexistente, mensaje rechazado):
+// reintentar no cambia nada, así que es un fallo permanente. Las 4xx y los
+// errores de red se reintentan.
+func smtpError(step string, err error) error {
+	wrapped := fmt.Errorf("%s: %v", step, err)
+	var reply *textproto.Error
+	if errors.As(err, &reply) && reply.Code >= 500 && reply.Code < 600 {
+		return service.Permanent(wrapped)
+	}
+	return wrapped
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"taskProcessor/models"
+	"taskProcessor/service"
+	"testing"
+	"time"
+)
+
+// fakeSMTP servidor SMTP mínimo en 127.0.0.1 que guarda lo que recibe.
+// rcptReply es la respuesta a RCPT TO (vacío = "250 OK").
+type fakeSMTP struct {
+	listener  net.Listener
+	rcptReply string
+
+	mu   sync.Mutex
+	rcpt []string
+	data []string
+}
+
+func startFakeSMTP(t *testing.T, rcptReply string) *fakeSMTP {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("no se pudo abrir el listener: %v", err)
+	}
+	server := &fakeSMTP{listener: listener, rcptReply: rcptReply}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 fake ESMTP")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch {
+		case command == "EHLO" || command == "HELO":
+			reply("250 fake")
+		case strings.HasPrefix(strings.ToUpper(line), "MAIL FROM:"):
+			reply("250 OK")
+		case strings.HasPrefix(strings.ToUpper(line), "RCPT TO:"):
+			s.mu.Lock()
+			s.rcpt = append(s.rcpt, line[len("RCPT TO:"):])
+			s.mu.Unlock()
+			if s.rcptReply != "" {
+				reply(s.rcptReply)
+			} else {
+				reply("250 OK")
+			}
+		case command == "DATA":
+			reply("354 Fin con <CRLF>.<CRLF>")
+			var body strings.Builder
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				body.WriteString(dataLine)
+			}
+			s.mu.Lock()
+			s.data = append(s.data, body.String())
+			s.mu.Unlock()
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 Chau")
+			return
+		default:
+			reply("502 No implementado")
+		}
+	}
+}
+
+func (s *fakeSMTP) config() SMTPConfig {
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return SMTPConfig{Host: host, Port: port, From: "taskprocessor@localhost"}
+}
+
+func emailTask(payload map[string]interface{}) *models.Task {
+	return models.NewTask("send_email", "Email de prueba", payload)
+}
+
+func TestSendEmailDeliversToFakeServer(t *testing.T) {
+	server := startFakeSMTP(t, "")
+	handler := NewSendEmailHandler(server.config())
+
+	task := emailTask(map[string]interface{}{
+		"email":   "Juan Pérez <juan@example.com>",
+		"subject": "Bienvenido",
+		"body":    "Hola\nmundo",
+	})
+	result, err := handler(context.Background(), task)
+	if err != nil {
+		t.Fatalf("el envío falló: %v", err)
+	}
+	if !strings.Contains(result.Output, "juan@example.com") {
+		t.Errorf("Output inesperado: %q", result.Output)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.rcpt) != 1 || server.rcpt[0] != "<juan@example.com>" {
+		t.Errorf("RCPT TO debe llevar solo la dirección, recibió %q", server.rcpt)
+	}
+	if len(server.data) != 1 {
+		t.Fatalf("se esperaba un mensaje, llegaron %d", len(server.data))
+	}
+	message := server.data[0]
+	for _, want := range []string{"To: Juan Pérez <juan@example.com>\r\n", "Subject: Bienvenido\r\n", "Hola\r\nmundo"} {
+		if !strings.Contains(message, want) {
+			t.Errorf("el mensaje no contiene %q:\n%s", want, message)
+		}
+	}
+}
+
+func TestSendEmailSMTPReplies(t *testing.T) {
+	tests := []struct {
+		name      string
+		reply     string
+		permanent bool
+	}{
+		{"5xx es permanente", "550 No existe el buzón", true},
+		{"4xx se reintenta", "451 Intente más tarde", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := startFakeSMTP(t, test.reply)
+			handler := NewSendEmailHandler(server.config())
+
+			_, err := handler(context.Background(), emailTask(map[string]interface{}{"email": "juan@example.com"}))
+			if err == nil {
+				t.Fatal("se esperaba un error")
+			}
+			var permanentErr *service.PermanentError
+			if got := errors.As(err, &permanentErr); got != test.permanent {
+				t.Errorf("permanente = %v, se esperaba %v (error: %v)", got, test.permanent, err)
+			}
+		})
+	}
+}
+
+func TestSendEmailRejectsBadPayload(t *testing.T) {
+	handler := NewSendEmailHandler(SMTPConfig{Host: "127.0.0.1", Port: "1"})
+	payloads := map[string]map[string]interface{}{
+		"sin email":      {"subject": "Hola"},
+		"email inválido": {"email": "no-es-un-email"},
+		"email no texto": {"email": 42},
+	}
+	for name, payload := range payloads {
+		t.Run(name, func(t *testing.T) {
+			_, err := handler(context.Background(), emailTask(payload))
+			var permanentErr *service.PermanentError
+			if !errors.As(err, &permanentErr) {
+				t.Errorf("se esperaba un error permanente, se obtuvo %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"taskProcessor/models"
+	"taskProcessor/service"
+	"time"
+)
+
+// DefaultExecMaxOutput máximo de stdout que puede producir un comando
+const DefaultExecMaxOutput = 1 << 20
+
+// execWaitDelay cuánto se espera a que se cierren stdout/stderr después de matar
+// el proceso (por ejemplo, si dejó procesos hijos con las pipes abiertas)
+const execWaitDelay = 5 * time.Second
+
+// ExecConfig comandos que puede ejecutar el handler "exec"
+type ExecConfig struct {
+	Commands  map[string][]string // Nombre → argv; el payload solo elige el nombre
+	MaxOutput int                 // Bytes máximos de stdout (0 = DefaultExecMaxOutput)
+}
+
+// errOutputLimit se usa cuando el comando escribe más que el máximo permitido
+var errOutputLimit = errors.New("límite de salida superado")
+
+// NewExecHandler handler de "exec". El payload indica "command", que debe estar
+// en la lista de comandos permitidos; el payload completo se pasa como JSON por
+// stdin. El comando corre en un directorio temporal vacío y con un entorno mínimo.
+//
+// Código de salida: 0 es éxito (stdout es el resultado); 64-78 (sysexits.h) es un
+// fallo permanente, salvo 75 (EX_TEMPFAIL); cualquier otro se reintenta.
+// El timeout es el del tipo o la tarea (HandlerOptions.Timeout / timeout_seconds).
+func NewExecHandler(config ExecConfig) service.Handler {
+	if config.MaxOutput <= 0 {
+		config.MaxOutput = DefaultExecMaxOutput
+	}
+
+	return func(ctx context.Context, task *models.Task) (service.Result, error) {
+		name, err := payloadString(task, "command", true)
+		if err != nil {
+			return service.Result{}, err
+		}
+		argv, ok := config.Commands[name]
+		if !ok || len(argv) == 0 {
+			return service.Result{}, service.Permanent(fmt.Errorf("comando no permitido: %q", name))
+		}
+
+		stdin, err := json.Marshal(task.Payload)
+		if err != nil {
+			return service.Result{}, service.Permanent(fmt.Errorf("error al codificar el payload: %v", err))
+		}
+
+		workDir, err := os.MkdirTemp("", "task-exec-")
+		if err != nil {
+			return service.Result{}, fmt.Errorf("error al crear directorio de trabajo: %v", err)
+		}
+		defer os.RemoveAll(workDir)
+
+		stdout := &limitedBuffer{limit: config.MaxOutput, failOnLimit: true}
+		stderr := &limitedBuffer{limit: config.MaxOutput}
+
+		cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+		cmd.Dir = workDir
+		cmd.Env = execEnv(workDir, task)
+		cmd.Stdin = bytes.NewReader(stdin)
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		cmd.WaitDelay = execWaitDelay
+		isolateProcessGroup(cmd)
+
+		err = cmd.Run()
+		if err == nil {
+			return service.Result{Output: strings.TrimRight(stdout.String(), "\n")}, nil
+		}
+
+		// El plazo venció o el pool se detuvo: el error del contexto manda
+		if ctx.Err() != nil {
+			return service.Result{}, fmt.Errorf("comando %s interrumpido: %w", name, ctx.Err())
+		}
+		// El comando puede morir por SIGPIPE antes de que Run vea errOutputLimit
+		if errors.Is(err, errOutputLimit) || stdout.truncated {
+			return service.Result{}, service.Permanent(fmt.Errorf("comando %s: stdout supera %d bytes", name, config.MaxOutput))
+		}
+
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			// No se pudo lanzar (binario inexistente, permisos...)
+			return service.Result{}, fmt.Errorf("error al ejecutar %s: %v", name, err)
+		}
+
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = "sin salida de error"
+		}
+		failure := fmt.Errorf("comando %s terminó con código %d: %s", name, exitErr.ExitCode(), message)
+		if permanentExitCode(exitErr.ExitCode()) {
+			return service.Result{}, service.Permanent(failure)
+		}
+		return service.Result{}, failure
+	}
+}
+
+// permanentExitCode códigos de sysexits.h que indican un error que no se arregla
+// reintentando (datos inválidos, configuración...). EX_TEMPFAIL (75) se reintenta.
+func permanentExitCode(code int) bool {
+	return code >= 64 && code <= 78 && code != 75
+}
+
+// execEnv entorno mínimo del comando: no hereda credenciales del proceso
+func execEnv(workDir string, task *models.Task) []string {
+	return []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + workDir,
+		"TMPDIR=" + workDir,
+		"TASK_ID=" + task.ID.Hex(),
+		"TASK_TYPE=" + task.Type,
+		fmt.Sprintf("TASK_ATTEMPT=%d", task.Attempts),
+	}
+}
+
+// limitedBuffer guarda hasta limit bytes. Con failOnLimit la escritura que
+// supera el límite falla (el comando recibe un error al escribir); sin él el
+// resto se descarta en silencio.
+type limitedBuffer struct {
+	buffer      bytes.Buffer
+	limit       int
+	failOnLimit bool
+	truncated   bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	remaining := b.limit - b.buffer.Len()
+	if len(p) <= remaining {
+		return b.buffer.Write(p)
+	}
+	if b.failOnLimit {
+		b.truncated = true
+		return 0, errOutputLimit
+	}
+	if remaining > 0 {
+		b.buffer.Write(p[:remaining])
+	}
+	b.truncated = true
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	if b.truncated {
+		return b.buffer.String() + "…(truncado)"
+	}
+	return b.buffer.String()
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package handlers
+
+import "os/exec"
+
+// isolateProcessGroup sin grupos de procesos solo se mata al proceso principal
+// (comportamiento por defecto de exec.CommandContext)
+func isolateProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,169 @@
+//go:build unix
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"taskProcessor/models"
+	"testing"
+	"time"
+)
+
+// execTask tarea "exec" que corre el comando permitido name
+func execTask(name string, payload map[string]interface{}) *models.Task {
+	if payload == nil {
+		payload = map[string]interface{}{}
+	}
+	payload["command"] = name
+	return models.NewTask("exec", "Ejecutar "+name, payload)
+}
+
+func TestExecRejectsCommandsNotAllowed(t *testing.T) {
+	handler := NewExecHandler(ExecConfig{Commands: map[string][]string{
+		"echo":  {"echo", "hola"},
+		"vacio": {},
+	}})
+
+	for _, name := range []string{"rm", "/bin/echo", "vacio"} {
+		t.Run(name, func(t *testing.T) {
+			_, err := handler(context.Background(), execTask(name, nil))
+			if !isPermanent(err) || !strings.Contains(err.Error(), "no permitido") {
+				t.Errorf("error = %v, se esperaba un fallo permanente por comando no permitido", err)
+			}
+		})
+	}
+
+	task := models.NewTask("exec", "Sin comando", map[string]interface{}{})
+	if _, err := handler(context.Background(), task); !isPermanent(err) {
+		t.Errorf("sin command se esperaba un fallo permanente, error = %v", err)
+	}
+}
+
+func TestExecPassesPayloadOnStdin(t *testing.T) {
+	handler := NewExecHandler(ExecConfig{Commands: map[string][]string{"cat": {"cat"}}})
+	task := execTask("cat", map[string]interface{}{"user_id": 12345.0, "tags": []interface{}{"a", "b"}})
+
+	result, err := handler(context.Background(), task)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var received map[string]interface{}
+	if err := json.Unmarshal([]byte(result.Output), &received); err != nil {
+		t.Fatalf("stdin no es JSON: %q (%v)", result.Output, err)
+	}
+	if !reflect.DeepEqual(received, task.Payload) {
+		t.Errorf("el comando recibió %v, se esperaba %v", received, task.Payload)
+	}
+}
+
+func TestExecMinimalEnvironment(t *testing.T) {
+	handler := NewExecHandler(ExecConfig{Commands: map[string][]string{
+		"env": {"sh", "-c", `echo "$TASK_ID $TASK_TYPE $TASK_ATTEMPT $MONGODB_URI"`},
+	}})
+	t.Setenv("MONGODB_URI", "mongodb://secreto")
+	task := execTask("env", nil)
+	task.Attempts = 2
+
+	result, err := handler(context.Background(), task)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := fmt.Sprintf("%s exec 2 ", task.ID.Hex())
+	if result.Output != expected {
+		t.Errorf("entorno = %q, se esperaba %q", result.Output, expected)
+	}
+}
+
+func TestExecExitCodes(t *testing.T) {
+	tests := []struct {
+		code      int
+		permanent bool
+	}{
+		{1, false},
+		{2, false},
+		{63, false},
+		{64, true},  // EX_USAGE
+		{65, true},  // EX_DATAERR
+		{74, true},  // EX_IOERR
+		{75, false}, // EX_TEMPFAIL
+		{76, true},  // EX_PROTOCOL
+		{78, true},  // EX_CONFIG
+		{79, false},
+		{127, false},
+	}
+
+	commands := map[string][]string{"ok": {"sh", "-c", "echo listo"}}
+	for _, test := range tests {
+		commands[fmt.Sprint(test.code)] = []string{"sh", "-c", fmt.Sprintf("echo fallo %d >&2; exit %d", test.code, test.code)}
+	}
+	handler := NewExecHandler(ExecConfig{Commands: commands})
+
+	result, err := handler(context.Background(), execTask("ok", nil))
+	if err != nil || result.Output != "listo" {
+		t.Fatalf("código 0: resultado %q, error %v", result.Output, err)
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("código %d", test.code), func(t *testing.T) {
+			_, err := handler(context.Background(), execTask(fmt.Sprint(test.code), nil))
+			if err == nil {
+				t.Fatal("se esperaba un error")
+			}
+			if isPermanent(err) != test.permanent {
+				t.Errorf("permanente = %v, se esperaba %v: %v", isPermanent(err), test.permanent, err)
+			}
+			if !strings.Contains(err.Error(), fmt.Sprintf("fallo %d", test.code)) {
+				t.Errorf("el error no incluye stderr: %v", err)
+			}
+		})
+	}
+}
+
+func TestExecOutputLimit(t *testing.T) {
+	handler := NewExecHandler(ExecConfig{
+		MaxOutput: 16,
+		Commands: map[string][]string{
+			"justo":    {"printf", "0123456789abcdef"},
+			"excede":   {"printf", "0123456789abcdefg"},
+			"infinito": {"yes"},
+		},
+	})
+
+	if result, err := handler(context.Background(), execTask("justo", nil)); err != nil || result.Output != "0123456789abcdef" {
+		t.Errorf("en el límite: resultado %q, error %v", result.Output, err)
+	}
+	for _, name := range []string{"excede", "infinito"} {
+		t.Run(name, func(t *testing.T) {
+			_, err := handler(context.Background(), execTask(name, nil))
+			if !isPermanent(err) || !strings.Contains(err.Error(), "stdout supera 16 bytes") {
+				t.Errorf("error = %v, se esperaba un fallo permanente por límite de salida", err)
+			}
+		})
+	}
+}
+
+func TestExecTimeoutKillsProcessGroup(t *testing.T) {
+	// El proceso hijo hereda stdout: si solo se matara a sh, Run esperaría
+	// execWaitDelay a que se cierre la pipe
+	handler := NewExecHandler(ExecConfig{Commands: map[string][]string{
+		"lento": {"sh", "-c", "sleep 30 & wait"},
+	}})
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := handler(ctx, execTask("lento", nil))
+	elapsed := time.Since(start)
+
+	if !errors.Is(err, context.DeadlineExceeded) || isPermanent(err) {
+		t.Errorf("error = %v, se esperaba un fallo reintentable por timeout", err)
+	}
+	if elapsed >= execWaitDelay {
+		t.Errorf("el comando tardó %v en terminar: no se mató al grupo de procesos", elapsed)
+	}
+}
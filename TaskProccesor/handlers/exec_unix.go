@@ -0,0 +1,18 @@
+//go:build unix
+
+package handlers
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// isolateProcessGroup corre el comando en su propio grupo de procesos y, al
+// cancelarse el contexto, mata al grupo entero: un script no deja procesos
+// hijos vivos después del timeout
+func isolateProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
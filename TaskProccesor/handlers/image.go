@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // Registra el decoder de GIF para image.Decode
+	"image/jpeg"
+	_ "image/png" // Registra el decoder de PNG para image.Decode
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"taskProcessor/models"
+	"taskProcessor/service"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxImageBytes tamaño máximo de imagen que se acepta descargar o leer
+const maxImageBytes = 20 << 20
+
+// defaultThumbnailWidths anchos que se generan si el payload no indica "widths"
+var defaultThumbnailWidths = []int{150, 300}
+
+// imageDownloadTimeout plazo máximo de una descarga de image_url
+const imageDownloadTimeout = 30 * time.Second
+
+// errInternalAddress se usa cuando image_url apunta (o redirige) a una dirección interna
+var errInternalAddress = errors.New("dirección interna no permitida")
+
+// ImageConfig origen y destino de las imágenes del handler "process_image"
+type ImageConfig struct {
+	OutputDir string       // Donde se escriben las miniaturas
+	InputDir  string       // Único directorio del que se leen image_path y file:// (vacío = ninguno)
+	Client    *http.Client // Para image_url http(s) (nil = con timeout y sin direcciones internas)
+}
+
+// NewProcessImageHandler handler de "process_image". Lee la imagen de image_path
+// (archivo dentro de InputDir) o image_url (http, https o file://) y escribe una
+// miniatura JPEG por cada ancho de "widths" en OutputDir, manteniendo la proporción.
+func NewProcessImageHandler(config ImageConfig) service.Handler {
+	if config.Client == nil {
+		config.Client = imageClient()
+	}
+	outputDir := config.OutputDir
+
+	return func(ctx context.Context, task *models.Task) (service.Result, error) {
+		data, source, err := readImageSource(ctx, config, task)
+		if err != nil {
+			return service.Result{}, err
+		}
+		src, format, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return service.Result{}, service.Permanent(fmt.Errorf("no se pudo decodificar la imagen %s: %v", source, err))
+		}
+
+		widths, err := thumbnailWidths(task)
+		if err != nil {
+			return service.Result{}, err
+		}
+		if err := os.MkdirAll(outputDir, 0o755); err != nil {
+			return service.Result{}, fmt.Errorf("error al crear %s: %v", outputDir, err)
+		}
+
+		var paths []string
+		for _, width := range widths {
+			if err := ctx.Err(); err != nil {
+				return service.Result{}, err
+			}
+			path := filepath.Join(outputDir, fmt.Sprintf("%s_%d.jpg", task.ID.Hex(), width))
+			if err := writeJPEG(path, thumbnail(src, width)); err != nil {
+				return service.Result{}, err
+			}
+			paths = append(paths, path)
+		}
+
+		bounds := src.Bounds()
+		output := fmt.Sprintf("Imagen %s (%s %dx%d) → %s", source, format, bounds.Dx(), bounds.Dy(), strings.Join(paths, ", "))
+		return service.Result{Output: output}, nil
+	}
+}
+
+// readImageSource lee los bytes de la imagen indicada en el payload
+func readImageSource(ctx context.Context, config ImageConfig, task *models.Task) ([]byte, string, error) {
+	path, err := payloadString(task, "image_path", false)
+	if err != nil {
+		return nil, "", err
+	}
+	if path == "" {
+		rawURL, err := payloadString(task, "image_url", false)
+		if err != nil {
+			return nil, "", err
+		}
+		if rawURL == "" {
+			return nil, "", service.Permanent(fmt.Errorf("falta \"image_path\" o \"image_url\" en el payload"))
+		}
+		parsed, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, "", service.Permanent(fmt.Errorf("image_url inválida %q: %v", rawURL, err))
+		}
+		switch parsed.Scheme {
+		case "http", "https":
+			data, err := downloadImage(ctx, config.Client, rawURL)
+			return data, rawURL, err
+		case "file":
+			path = parsed.Path
+		default:
+			return nil, "", service.Permanent(fmt.Errorf("esquema no soportado en image_url: %q", parsed.Scheme))
+		}
+	}
+
+	data, err := readLocalImage(config.InputDir, path)
+	return data, path, err
+}
+
+// readLocalImage lee path (relativo a inputDir, o absoluto dentro de él) sin
+// salir de inputDir: además de rechazar "..", os.Root no sigue symlinks que escapan
+func readLocalImage(inputDir, path string) ([]byte, error) {
+	if inputDir == "" {
+		return nil, service.Permanent(fmt.Errorf("no se leen imágenes locales: IMAGE_INPUT_DIR no está configurado"))
+	}
+	if filepath.IsAbs(path) {
+		base, err := filepath.Abs(inputDir)
+		if err != nil {
+			return nil, fmt.Errorf("error al resolver %s: %v", inputDir, err)
+		}
+		if path, err = filepath.Rel(base, path); err != nil {
+			path = ".." // No está debajo de base
+		}
+	}
+	if !filepath.IsLocal(path) {
+		return nil, service.Permanent(fmt.Errorf("la imagen %s está fuera de %s", path, inputDir))
+	}
+
+	root, err := os.OpenRoot(inputDir)
+	if err != nil {
+		return nil, fmt.Errorf("error al abrir %s: %v", inputDir, err)
+	}
+	defer root.Close()
+
+	file, err := root.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error al abrir la imagen: %v", err)
+	}
+	defer file.Close()
+	return readLimited(file)
+}
+
+// imageClient cliente por defecto para image_url: con timeout y sin conectarse a
+// direcciones internas (loopback, redes privadas, link-local), tampoco después
+// de una redirección, porque se valida cada conexión y no la URL
+func imageClient() *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: denyInternalAddress}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // Con proxy se validaría la dirección del proxy y no la del destino
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: imageDownloadTimeout, Transport: transport}
+}
+
+// denyInternalAddress Control del dialer: rechaza la conexión a direcciones internas
+func denyInternalAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("%w: %s", errInternalAddress, ip)
+	}
+	return nil
+}
+
+// downloadImage descarga la imagen respetando el contexto y el tamaño máximo
+func downloadImage(ctx context.Context, client *http.Client, rawURL string) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		if errors.Is(err, errInternalAddress) {
+			return nil, service.Permanent(fmt.Errorf("error al descargar la imagen: %v", err))
+		}
+		return nil, fmt.Errorf("error al descargar la imagen: %v", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error al descargar la imagen: %s", response.Status)
+	}
+	return readLimited(response.Body)
+}
+
+// readLimited lee todo el reader fallando si supera maxImageBytes
+func readLimited(reader io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(reader, maxImageBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("error al leer la imagen: %v", err)
+	}
+	if len(data) > maxImageBytes {
+		return nil, service.Permanent(fmt.Errorf("la imagen supera el máximo de %d MB", maxImageBytes>>20))
+	}
+	return data, nil
+}
+
+// thumbnailWidths anchos pedidos en el payload ("widths": [150, 300])
+func thumbnailWidths(task *models.Task) ([]int, error) {
+	var values []interface{}
+	switch list := task.Payload["widths"].(type) {
+	case nil:
+		return defaultThumbnailWidths, nil
+	case []interface{}:
+		values = list
+	case primitive.A: // Así llegan los arrays leídos de MongoDB
+		values = list
+	default:
+		return nil, service.Permanent(fmt.Errorf("\"widths\" debe ser una lista de números, es %T", list))
+	}
+
+	widths := make([]int, 0, len(values))
+	for _, value := range values {
+		width, ok := toInt(value)
+		if !ok || width <= 0 {
+			return nil, service.Permanent(fmt.Errorf("ancho de miniatura inválido: %v", value))
+		}
+		widths = append(widths, width)
+	}
+	if len(widths) == 0 {
+		return defaultThumbnailWidths, nil
+	}
+	return widths, nil
+}
+
+// thumbnail reduce la imagen a width píxeles de ancho promediando cada bloque
+// de píxeles de origen (no se agranda si ya es más chica)
+func thumbnail(src image.Image, width int) *image.RGBA64 {
+	bounds := src.Bounds()
+	if width > bounds.Dx() {
+		width = bounds.Dx()
+	}
+	height := max(1, bounds.Dy()*width/bounds.Dx())
+
+	dst := image.NewRGBA64(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := bounds.Min.Y + (y+1)*bounds.Dy()/height
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := bounds.Min.X + (x+1)*bounds.Dx()/width
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.SetRGBA64(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)})
+		}
+	}
+	return dst
+}
+
+// writeJPEG guarda la imagen como JPEG
+func writeJPEG(path string, img image.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error al crear la miniatura: %v", err)
+	}
+	if err := jpeg.Encode(file, img, &jpeg.Options{Quality: 85}); err != nil {
+		file.Close()
+		return fmt.Errorf("error al codificar la miniatura: %v", err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"taskProcessor/models"
+	"taskProcessor/service"
+	"testing"
+)
+
+// writeTestPNG genera un PNG de width x height en dir y retorna su ruta
+func writeTestPNG(t *testing.T, dir string, width, height int) string {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	path := filepath.Join(dir, "source.png")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := png.Encode(file, img); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestProcessImageWritesThumbnails(t *testing.T) {
+	dir := t.TempDir()
+	source := writeTestPNG(t, dir, 400, 200)
+	outputDir := filepath.Join(dir, "thumbnails")
+	handler := NewProcessImageHandler(ImageConfig{OutputDir: outputDir, InputDir: dir})
+
+	task := models.NewTask("process_image", "Procesar imagen", map[string]interface{}{
+		"image_path": source,
+		"widths":     []interface{}{100, 300.0, 800}, // 800 no agranda: queda en 400
+	})
+	if _, err := handler(context.Background(), task); err != nil {
+		t.Fatalf("el handler falló: %v", err)
+	}
+
+	expected := map[int]image.Point{100: {100, 50}, 300: {300, 150}, 800: {400, 200}}
+	for width, size := range expected {
+		path := filepath.Join(outputDir, fmt.Sprintf("%s_%d.jpg", task.ID.Hex(), width))
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("falta la miniatura de %d: %v", width, err)
+		}
+		thumb, err := jpeg.Decode(file)
+		file.Close()
+		if err != nil {
+			t.Fatalf("la miniatura de %d no es un JPEG válido: %v", width, err)
+		}
+		if got := thumb.Bounds().Size(); got != size {
+			t.Errorf("miniatura de %d: tamaño %v, se esperaba %v", width, got, size)
+		}
+	}
+}
+
+func TestProcessImageRejectsBadPayload(t *testing.T) {
+	dir := t.TempDir()
+	source := writeTestPNG(t, dir, 10, 10)
+	notAnImage := filepath.Join(dir, "texto.png")
+	os.WriteFile(notAnImage, []byte("no soy una imagen"), 0o644)
+	handler := NewProcessImageHandler(ImageConfig{OutputDir: filepath.Join(dir, "out"), InputDir: dir})
+
+	payloads := map[string]map[string]interface{}{
+		"sin origen":        {},
+		"esquema inválido":  {"image_url": "ftp://example.com/a.png"},
+		"no es una imagen":  {"image_path": notAnImage},
+		"widths no lista":   {"image_path": source, "widths": "150"},
+		"ancho negativo":    {"image_path": source, "widths": []interface{}{-5}},
+		"image_path número": {"image_path": 12},
+	}
+	for name, payload := range payloads {
+		t.Run(name, func(t *testing.T) {
+			_, err := handler(context.Background(), models.NewTask("process_image", "Procesar imagen", payload))
+			var permanentErr *service.PermanentError
+			if !errors.As(err, &permanentErr) {
+				t.Errorf("se esperaba un error permanente, se obtuvo %v", err)
+			}
+		})
+	}
+}
+
+func TestProcessImageReadsOnlyFromInputDir(t *testing.T) {
+	dir := t.TempDir()
+	inputDir := filepath.Join(dir, "entrada")
+	os.Mkdir(inputDir, 0o755)
+	source := writeTestPNG(t, inputDir, 10, 10)
+	secret := writeTestPNG(t, dir, 10, 10) // Fuera de inputDir
+	if err := os.Symlink(secret, filepath.Join(inputDir, "enlace.png")); err != nil {
+		t.Fatal(err)
+	}
+	handler := NewProcessImageHandler(ImageConfig{OutputDir: filepath.Join(dir, "out"), InputDir: inputDir})
+
+	allowed := map[string]map[string]interface{}{
+		"relativa":        {"image_path": "source.png"},
+		"absoluta dentro": {"image_path": source},
+		"file:// dentro":  {"image_url": "file://" + source},
+	}
+	for name, payload := range allowed {
+		t.Run(name, func(t *testing.T) {
+			if _, err := handler(context.Background(), models.NewTask("process_image", "Imagen", payload)); err != nil {
+				t.Errorf("se esperaba leer la imagen: %v", err)
+			}
+		})
+	}
+
+	denied := map[string]map[string]interface{}{
+		"con ..":           {"image_path": "../source.png"},
+		"absoluta afuera":  {"image_path": secret},
+		"file:// afuera":   {"image_url": "file:///etc/passwd"},
+		"symlink que sale": {"image_path": "enlace.png"},
+	}
+	for name, payload := range denied {
+		t.Run(name, func(t *testing.T) {
+			if _, err := handler(context.Background(), models.NewTask("process_image", "Imagen", payload)); err == nil {
+				t.Error("se leyó una imagen fuera de InputDir")
+			}
+		})
+	}
+
+	noInput := NewProcessImageHandler(ImageConfig{OutputDir: filepath.Join(dir, "out")})
+	if _, err := noInput(context.Background(), models.NewTask("process_image", "Imagen", map[string]interface{}{"image_path": source})); !isPermanent(err) {
+		t.Errorf("sin InputDir se esperaba un fallo permanente, error = %v", err)
+	}
+}
+
+func TestProcessImageDownload(t *testing.T) {
+	dir := t.TempDir()
+	data, err := os.ReadFile(writeTestPNG(t, dir, 20, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write(data)
+	}))
+	defer server.Close()
+	task := func() *models.Task {
+		return models.NewTask("process_image", "Imagen", map[string]interface{}{"image_url": server.URL + "/a.png"})
+	}
+
+	handler := NewProcessImageHandler(ImageConfig{OutputDir: filepath.Join(dir, "out"), Client: server.Client()})
+	if _, err := handler(context.Background(), task()); err != nil {
+		t.Fatalf("la descarga falló: %v", err)
+	}
+
+	// El cliente por defecto no se conecta a direcciones internas como 127.0.0.1
+	handler = NewProcessImageHandler(ImageConfig{OutputDir: filepath.Join(dir, "out")})
+	if _, err := handler(context.Background(), task()); !isPermanent(err) || !strings.Contains(err.Error(), errInternalAddress.Error()) {
+		t.Errorf("se esperaba un fallo permanente por dirección interna, error = %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"fmt"
+	"taskProcessor/models"
+	"taskProcessor/service"
+)
+
+// payloadString lee un string del payload. Si required y falta, retorna error.
+// Los errores de payload son permanentes: reintentar no los arregla.
+func payloadString(task *models.Task, key string, required bool) (string, error) {
+	value, ok := task.Payload[key]
+	if !ok || value == nil {
+		if required {
+			return "", service.Permanent(fmt.Errorf("falta %q en el payload", key))
+		}
+		return "", nil
+	}
+	text, ok := value.(string)
+	if !ok {
+		return "", service.Permanent(fmt.Errorf("%q debe ser un string, es %T", key, value))
+	}
+	return text, nil
+}
+
+// payloadInt lee un número entero del payload, o defaultValue si no está
+func payloadInt(task *models.Task, key string, defaultValue int) (int, error) {
+	value, ok := task.Payload[key]
+	if !ok || value == nil {
+		return defaultValue, nil
+	}
+	number, ok := toInt(value)
+	if !ok {
+		return 0, service.Permanent(fmt.Errorf("%q debe ser un número, es %T", key, value))
+	}
+	return number, nil
+}
+
+// toInt convierte los tipos numéricos con que llegan los payloads desde JSON o BSON
+func toInt(value interface{}) (int, bool) {
+	switch number := value.(type) {
+	case int:
+		return number, true
+	case int32:
+		return int(number), true
+	case int64:
+		return int(number), true
+	case float64:
+		return int(number), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"taskProcessor/models"
+	"taskProcessor/repository"
+	"taskProcessor/service"
+	"time"
+)
+
+// reportTypePattern valores válidos de report_type
+var reportTypePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// report contenido de un reporte de estadísticas de la cola
+type report struct {
+	Type        string           `json:"report_type"`
+	GeneratedAt time.Time        `json:"generated_at"`
+	Total       int64            `json:"total"`
+	ByStatus    map[string]int64 `json:"by_status"`
+	ByType      map[string]int64 `json:"by_type"`
+	ByQueue     map[string]int64 `json:"by_queue"`
+}
+
+// NewGenerateReportHandler handler de "generate_report". Escribe en outputDir un
+// reporte con las estadísticas actuales de la cola. Payload: report_type (opcional)
+// y format "json" (por defecto) o "csv".
+func NewGenerateReportHandler(repo *repository.TaskRepository, outputDir string) service.Handler {
+	return func(ctx context.Context, task *models.Task) (service.Result, error) {
+		reportType, err := payloadString(task, "report_type", false)
+		if err != nil {
+			return service.Result{}, err
+		}
+		if reportType == "" {
+			reportType = "summary"
+		}
+		// Se usa en el nombre del archivo: nada de separadores de ruta
+		if !reportTypePattern.MatchString(reportType) {
+			return service.Result{}, service.Permanent(fmt.Errorf("report_type inválido: %q", reportType))
+		}
+		format, err := payloadString(task, "format", false)
+		if err != nil {
+			return service.Result{}, err
+		}
+		if format == "" {
+			format = "json"
+		}
+		if format != "json" && format != "csv" {
+			return service.Result{}, service.Permanent(fmt.Errorf("formato de reporte no soportado: %q", format))
+		}
+
+		stats, err := repo.Stats(ctx)
+		if err != nil {
+			return service.Result{}, err
+		}
+		data := report{
+			Type:        reportType,
+			GeneratedAt: time.Now(),
+			Total:       stats.Total,
+			ByStatus:    stats.ByStatus,
+			ByType:      stats.ByType,
+			ByQueue:     stats.ByQueue,
+		}
+
+		if err := os.MkdirAll(outputDir, 0o755); err != nil {
+			return service.Result{}, fmt.Errorf("error al crear %s: %v", outputDir, err)
+		}
+		path := filepath.Join(outputDir, fmt.Sprintf("%s_%s.%s", reportType, task.ID.Hex(), format))
+		if format == "csv" {
+			err = writeCSVReport(path, data)
+		} else {
+			err = writeJSONReport(path, data)
+		}
+		if err != nil {
+			return service.Result{}, err
+		}
+		return service.Result{Output: fmt.Sprintf("Reporte %s generado en %s (%d tareas)", reportType, path, data.Total)}, nil
+	}
+}
+
+// writeJSONReport guarda el reporte como JSON indentado
+func writeJSONReport(path string, data report) error {
+	content, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error al codificar el reporte: %v", err)
+	}
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		return fmt.Errorf("error al escribir el reporte: %v", err)
+	}
+	return nil
+}
+
+// writeCSVReport guarda el reporte como CSV con columnas grupo,clave,tareas
+func writeCSVReport(path string, data report) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error al crear el reporte: %v", err)
+	}
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"grupo", "clave", "tareas"})
+	writer.Write([]string{"total", "", strconv.FormatInt(data.Total, 10)})
+	for _, group := range []struct {
+		name   string
+		counts map[string]int64
+	}{
+		{"status", data.ByStatus},
+		{"type", data.ByType},
+		{"queue", data.ByQueue},
+	} {
+		keys := make([]string, 0, len(group.counts))
+		for key := range group.counts {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			writer.Write([]string{group.name, key, strconv.FormatInt(group.counts[key], 10)})
+		}
+	}
+	writer.Flush()
+
+	if err := writer.Error(); err != nil {
+		file.Close()
+		return fmt.Errorf("error al escribir el reporte: %v", err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"taskProcessor/models"
+	"taskProcessor/service"
+	"testing"
+	"time"
+)
+
+func testReport() report {
+	return report{
+		Type:        "summary",
+		GeneratedAt: time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC),
+		Total:       6,
+		ByStatus:    map[string]int64{"processed": 4, "dead": 1, "pending": 1},
+		ByType:      map[string]int64{"send_email": 5, "process_image": 1},
+		ByQueue:     map[string]int64{"default": 6},
+	}
+}
+
+func TestWriteJSONReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reporte.json")
+	data := testReport()
+	if err := writeJSONReport(path, data); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded report
+	if err := json.Unmarshal(content, &decoded); err != nil {
+		t.Fatalf("el reporte no es JSON válido: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, data) {
+		t.Errorf("reporte leído %+v, se esperaba %+v", decoded, data)
+	}
+}
+
+func TestWriteCSVReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reporte.csv")
+	if err := writeCSVReport(path, testReport()); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatalf("el reporte no es CSV válido: %v", err)
+	}
+
+	// Los grupos en orden fijo y las claves de cada grupo ordenadas
+	expected := [][]string{
+		{"grupo", "clave", "tareas"},
+		{"total", "", "6"},
+		{"status", "dead", "1"},
+		{"status", "pending", "1"},
+		{"status", "processed", "4"},
+		{"type", "process_image", "1"},
+		{"type", "send_email", "5"},
+		{"queue", "default", "6"},
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("filas %v, se esperaba %v", rows, expected)
+	}
+}
+
+func TestGenerateReportRejectsBadPayload(t *testing.T) {
+	// Los payloads inválidos se rechazan antes de consultar el repositorio
+	handler := NewGenerateReportHandler(nil, t.TempDir())
+	payloads := map[string]map[string]interface{}{
+		"report_type con ruta": {"report_type": "../../etc/passwd"},
+		"report_type número":   {"report_type": 3},
+		"formato desconocido":  {"format": "xml"},
+	}
+	for name, payload := range payloads {
+		t.Run(name, func(t *testing.T) {
+			_, err := handler(context.Background(), models.NewTask("generate_report", "Generar reporte", payload))
+			var permanentErr *service.PermanentError
+			if !errors.As(err, &permanentErr) {
+				t.Errorf("se esperaba un error permanente, se obtuvo %v", err)
+			}
+		})
+	}
+}
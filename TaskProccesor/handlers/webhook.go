@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"taskProcessor/models"
+	"taskProcessor/repository"
+	"taskProcessor/service"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrWebhookSecretMissing se retorna al intentar entregar un webhook sin clave
+// de firma: el receptor no tendría cómo verificar el origen
+var ErrWebhookSecretMissing = errors.New("WEBHOOK_SECRET no está configurado: no se entregan webhooks sin firma")
+
+// WebhookConfig opciones del handler de webhooks
+type WebhookConfig struct {
+	Secret string       // Clave HMAC de la firma (obligatoria)
+	Client *http.Client // nil = cliente con timeout de 10 segundos. Nunca sigue redirecciones.
+}
+
+// WebhookPayload cuerpo JSON que recibe el callback_url de una tarea terminada
+type WebhookPayload struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Queue     string    `json:"queue"`
+	Title     string    `json:"title"`
+	Status    string    `json:"status"`
+	Attempts  int       `json:"attempts"`
+	Result    string    `json:"result,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SignWebhook firma de un webhook: HMAC-SHA256 en hex de "<timestamp>.<cuerpo>".
+// El receptor la recalcula con la misma clave para verificar el origen.
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewWebhookHandler handler de las tareas "webhook" (las encola CallbackDispatcher).
+// Hace POST firmado del resumen de la tarea al callback_url y registra cada intento.
+// Respuesta 2xx es éxito; 3xx y 4xx (salvo 408 y 429) son fallos permanentes; el
+// resto se reintenta con el backoff del tipo. Sin config.Secret no entrega nada.
+func NewWebhookHandler(repo *repository.TaskRepository, deliveries *repository.WebhookRepository, config WebhookConfig) service.Handler {
+	client := webhookClient(config.Client)
+
+	return func(ctx context.Context, task *models.Task) (service.Result, error) {
+		rawID, err := payloadString(task, "task_id", true)
+		if err != nil {
+			return service.Result{}, err
+		}
+		targetID, err := primitive.ObjectIDFromHex(rawID)
+		if err != nil {
+			return service.Result{}, service.Permanent(fmt.Errorf("task_id inválido: %q", rawID))
+		}
+		url, err := payloadString(task, "url", true)
+		if err != nil {
+			return service.Result{}, err
+		}
+		status, err := payloadString(task, "status", true)
+		if err != nil {
+			return service.Result{}, err
+		}
+
+		target, err := repo.GetByID(ctx, targetID)
+		if err != nil {
+			return service.Result{}, err
+		}
+		if target == nil {
+			return service.Result{}, service.Permanent(fmt.Errorf("la tarea %s ya no existe", rawID))
+		}
+
+		// El estado es el que disparó el webhook, aunque la tarea ya haya cambiado
+		body, err := json.Marshal(WebhookPayload{
+			ID:        target.ID.Hex(),
+			Type:      target.Type,
+			Queue:     target.Queue,
+			Title:     target.Title,
+			Status:    status,
+			Attempts:  target.Attempts,
+			Result:    target.Result,
+			LastError: target.LastError,
+			CreatedAt: target.CreatedAt,
+		})
+		if err != nil {
+			return service.Result{}, service.Permanent(fmt.Errorf("error al codificar el webhook: %v", err))
+		}
+
+		delivery := &models.WebhookDelivery{
+			TaskID:         targetID,
+			DeliveryTaskID: task.ID,
+			URL:            url,
+			TaskStatus:     status,
+			Attempt:        task.Attempts,
+		}
+		start := time.Now()
+		statusCode, deliverErr := postWebhook(ctx, client, url, task.ID.Hex(), config.Secret, body)
+		delivery.DurationMs = time.Since(start).Milliseconds()
+		delivery.StatusCode = statusCode
+		delivery.Success = deliverErr == nil
+		if deliverErr != nil {
+			delivery.Error = deliverErr.Error()
+		}
+		if err := deliveries.Record(ctx, delivery); err != nil {
+			return service.Result{}, err
+		}
+
+		if deliverErr != nil {
+			return service.Result{}, deliverErr
+		}
+		return service.Result{Output: fmt.Sprintf("Webhook entregado a %s (%d)", url, statusCode)}, nil
+	}
+}
+
+// webhookClient copia de base (o uno con timeout de 10 segundos si es nil) que no
+// sigue redirecciones: podrían llevar el cuerpo firmado a otro host
+func webhookClient(base *http.Client) *http.Client {
+	client := &http.Client{Timeout: 10 * time.Second}
+	if base != nil {
+		copied := *base
+		client = &copied
+	}
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return client
+}
+
+// postWebhook envía el cuerpo firmado. Retorna el código HTTP (0 si no hubo respuesta)
+// y error si no fue 2xx: permanente si reintentar no cambia la respuesta (3xx,
+// 4xx salvo 408 y 429, falta de clave), reintentable si no.
+func postWebhook(ctx context.Context, client *http.Client, url, deliveryID, secret string, body []byte) (int, error) {
+	if secret == "" {
+		return 0, service.Permanent(ErrWebhookSecretMissing)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, service.Permanent(fmt.Errorf("callback_url inválida: %v", err))
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "TaskProcessor-Webhook/1.0")
+	request.Header.Set("X-Webhook-ID", deliveryID)
+	request.Header.Set("X-Webhook-Timestamp", timestamp)
+	request.Header.Set("X-Webhook-Signature", "sha256="+SignWebhook(secret, timestamp, body))
+
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, fmt.Errorf("error al enviar webhook: %v", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		snippet, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		err := fmt.Errorf("webhook rechazado con %s: %s", response.Status, strings.TrimSpace(string(snippet)))
+		code := response.StatusCode
+		if code < 500 && code != http.StatusRequestTimeout && code != http.StatusTooManyRequests {
+			return code, service.Permanent(err)
+		}
+		return code, err
+	}
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+	return response.StatusCode, nil
+}
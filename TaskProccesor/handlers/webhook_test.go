@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"taskProcessor/service"
+	"testing"
+	"time"
+)
+
+const testWebhookSecret = "secreto-de-prueba"
+
+// webhookReceiver receptor httptest que verifica la firma y responde los
+// códigos de statuses en orden (el último se repite)
+func webhookReceiver(t *testing.T, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		call := int(calls.Add(1))
+		body, _ := io.ReadAll(request.Body)
+
+		timestamp := request.Header.Get("X-Webhook-Timestamp")
+		if _, err := strconv.ParseInt(timestamp, 10, 64); err != nil {
+			t.Errorf("X-Webhook-Timestamp inválido: %q", timestamp)
+		}
+		expected := "sha256=" + SignWebhook(testWebhookSecret, timestamp, body)
+		if got := request.Header.Get("X-Webhook-Signature"); got != expected {
+			t.Errorf("firma %q, se esperaba %q", got, expected)
+		}
+		if request.Header.Get("X-Webhook-ID") != "entrega-1" {
+			t.Errorf("X-Webhook-ID inesperado: %q", request.Header.Get("X-Webhook-ID"))
+		}
+
+		writer.WriteHeader(statuses[min(call, len(statuses))-1])
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func isPermanent(err error) bool {
+	var permanentErr *service.PermanentError
+	return errors.As(err, &permanentErr)
+}
+
+func TestPostWebhookSignsTheBody(t *testing.T) {
+	server, calls := webhookReceiver(t, http.StatusNoContent)
+
+	status, err := postWebhook(context.Background(), webhookClient(nil), server.URL, "entrega-1", testWebhookSecret, []byte(`{"id":"1"}`))
+	if err != nil || status != http.StatusNoContent {
+		t.Fatalf("status %d, error %v", status, err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("el receptor recibió %d llamadas", calls.Load())
+	}
+}
+
+func TestPostWebhookRetriesOn5xx(t *testing.T) {
+	server, calls := webhookReceiver(t, http.StatusServiceUnavailable, http.StatusOK)
+	client := webhookClient(nil)
+	body := []byte(`{"id":"1"}`)
+
+	status, err := postWebhook(context.Background(), client, server.URL, "entrega-1", testWebhookSecret, body)
+	if err == nil || isPermanent(err) || status != http.StatusServiceUnavailable {
+		t.Fatalf("un 503 debe ser un error reintentable: status %d, error %v", status, err)
+	}
+
+	// El reintento (otro intento de la tarea) llega bien
+	status, err = postWebhook(context.Background(), client, server.URL, "entrega-1", testWebhookSecret, body)
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("el reintento falló: status %d, error %v", status, err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("el receptor recibió %d llamadas, se esperaban 2", calls.Load())
+	}
+}
+
+func TestPostWebhookStatusClassification(t *testing.T) {
+	tests := []struct {
+		status    int
+		permanent bool
+	}{
+		{http.StatusBadRequest, true},
+		{http.StatusNotFound, true},
+		{http.StatusGone, true},
+		{http.StatusRequestTimeout, false},
+		{http.StatusTooManyRequests, false},
+		{http.StatusInternalServerError, false},
+		{http.StatusBadGateway, false},
+	}
+	for _, test := range tests {
+		t.Run(strconv.Itoa(test.status), func(t *testing.T) {
+			server, _ := webhookReceiver(t, test.status)
+			_, err := postWebhook(context.Background(), webhookClient(nil), server.URL, "entrega-1", testWebhookSecret, []byte("{}"))
+			if err == nil {
+				t.Fatal("se esperaba un error")
+			}
+			if isPermanent(err) != test.permanent {
+				t.Errorf("permanente = %v, se esperaba %v (%v)", isPermanent(err), test.permanent, err)
+			}
+		})
+	}
+}
+
+func TestPostWebhookDoesNotFollowRedirects(t *testing.T) {
+	var followed atomic.Bool
+	target := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		followed.Store(true)
+	}))
+	defer target.Close()
+	redirect := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	defer redirect.Close()
+
+	// Aunque el cliente de base siga redirecciones, el del webhook no
+	base := &http.Client{Timeout: time.Second}
+	status, err := postWebhook(context.Background(), webhookClient(base), redirect.URL, "entrega-1", testWebhookSecret, []byte("{}"))
+	if followed.Load() {
+		t.Fatal("se siguió la redirección")
+	}
+	if status != http.StatusTemporaryRedirect || !isPermanent(err) {
+		t.Errorf("status %d, error %v: se esperaba un 307 permanente", status, err)
+	}
+}
+
+func TestPostWebhookRequiresSecret(t *testing.T) {
+	server, calls := webhookReceiver(t, http.StatusOK)
+
+	_, err := postWebhook(context.Background(), webhookClient(nil), server.URL, "entrega-1", "", []byte("{}"))
+	if !errors.Is(err, ErrWebhookSecretMissing) || !isPermanent(err) {
+		t.Errorf("se esperaba ErrWebhookSecretMissing permanente, se obtuvo %v", err)
+	}
+	if calls.Load() != 0 {
+		t.Error("no se debe enviar un webhook sin firma")
+	}
+}
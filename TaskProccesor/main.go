@@ -4,10 +4,20 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 	"taskProcessor/config"
 	"taskProcessor/database"
+	"taskProcessor/events"
+	"taskProcessor/handlers"
 	"taskProcessor/models"
 	"taskProcessor/repository"
+	"taskProcessor/service"
+	"taskProcessor/transport"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -28,8 +38,22 @@ func main() {
 	}
 	defer mongoDB.Disconnect()
 
-	// 3. Crear repositorio
+	// 3. Crear repositorios
 	taskRepo := repository.NewTaskRepository(mongoDB.GetCollection("tasks"))
+	bus := events.NewBus()
+	taskRepo.SetEventBus(bus)
+	pauseRepo := repository.NewPauseRepository(mongoDB.GetCollection("queue_pauses"))
+
+	if err := taskRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Printf("❌ %v", err)
+	}
+
+	// Tareas de versiones sin status (solo processed): si no, nunca se reclaman
+	if migrated, err := taskRepo.BackfillStatus(context.Background()); err != nil {
+		log.Printf("❌ %v", err)
+	} else if migrated > 0 {
+		log.Printf("🔧 %d tareas antiguas recibieron status", migrated)
+	}
 
 	// 4. Probar operaciones
 	ctx := context.Background()
@@ -39,25 +63,33 @@ func main() {
 	// === CREAR TAREAS ===
 	fmt.Println("\n➕ Creando nuevas tareas...")
 	tasks := []*models.Task{
-		models.NewTask("Enviar email de bienvenida", map[string]interface{}{
+		models.NewTask("send_email", "Enviar email de bienvenida", map[string]interface{}{
 			"email":   "user@example.com",
 			"subject": "Bienvenido",
 		}),
-		models.NewTask("Procesar imagen", map[string]interface{}{
-			"image_url": "https://example.com/image.jpg",
-			"format":    "thumbnail",
+		models.NewTask("process_image", "Procesar imagen", map[string]interface{}{
+			"image_path": "sample.png", // Relativa a IMAGE_INPUT_DIR
+			"widths":     []int{150, 300},
+			"report":     true,
 		}),
-		models.NewTask("Generar reporte", map[string]interface{}{
+		models.NewTask("generate_report", "Generar reporte", map[string]interface{}{
 			"report_type": "monthly",
 			"user_id":     12345,
 		}),
 	}
+	// Nunca dos reportes del mismo usuario a la vez
+	tasks[2].ConcurrencyKey = "report:user:12345"
 
-	for _, task := range tasks {
-		if err := taskRepo.Create(ctx, task); err != nil {
-			log.Printf("❌ Error al crear tarea: %v", err)
-		} else {
-			fmt.Printf("✅ Tarea creada: %s (ID: %s)\n", task.Title, task.ID.Hex())
+	itemErrors, err := taskRepo.CreateMany(ctx, tasks)
+	if err != nil {
+		log.Printf("❌ Error al crear tareas: %v", err)
+	} else {
+		for i, task := range tasks {
+			if itemErrors[i] != nil {
+				log.Printf("❌ Error al crear tarea %s: %v", task.Title, itemErrors[i])
+			} else {
+				fmt.Printf("✅ Tarea creada: %s (ID: %s)\n", task.Title, task.ID.Hex())
+			}
 		}
 	}
 
@@ -83,10 +115,18 @@ func main() {
 		fmt.Printf("   Worker: %s\n", claimed.ClaimedBy)
 		fmt.Printf("   Intentos: %d\n", claimed.Attempts)
 
+		// === REPORTAR PROGRESO ===
+		progress := models.TaskProgress{Percent: 50, Message: "Procesando..."}
+		if err := taskRepo.UpdateProgress(ctx, claimed.ID, claimed.ClaimedBy, progress); err != nil {
+			log.Printf("❌ Error al reportar progreso: %v", err)
+		} else {
+			fmt.Printf("   Progreso: %d%%\n", progress.Percent)
+		}
+
 		// === MARCAR COMO PROCESADA ===
 		fmt.Println("\n✔️  Marcando tarea como procesada...")
 		result := fmt.Sprintf("Procesada exitosamente por %s", claimed.ClaimedBy)
-		if err := taskRepo.MarkAsProcessed(ctx, claimed.ID, result); err != nil {
+		if err := taskRepo.MarkAsProcessed(ctx, claimed.ID, claimed.ClaimedBy, result); err != nil {
 			log.Printf("❌ Error: %v", err)
 		} else {
 			fmt.Println("✅ Tarea procesada exitosamente")
@@ -97,10 +137,14 @@ func main() {
 
 	// === ESTADÍSTICAS ===
 	fmt.Println("\n📊 Estadísticas finales:")
-	total, _ := taskRepo.CountAll(ctx)
-	pendingCount, _ := taskRepo.CountPending(ctx)
-	fmt.Printf("   Total: %d | Pendientes: %d | Procesadas: %d\n",
-		total, pendingCount, total-pendingCount)
+	stats, err := taskRepo.Stats(ctx)
+	if err != nil {
+		log.Printf("❌ Error: %v", err)
+	} else {
+		fmt.Printf("   Total: %d | Pendientes: %d | En proceso: %d | Procesadas: %d\n",
+			stats.Total, stats.ByStatus[models.StatusPending],
+			stats.ByStatus[models.StatusRunning], stats.ByStatus[models.StatusProcessed])
+	}
 
 	// === LISTAR TODAS LAS TAREAS ===
 	fmt.Println("\n📚 Todas las tareas en la base de datos:")
@@ -110,14 +154,171 @@ func main() {
 	} else {
 		for i, task := range allTasks {
 			status := "❌ Pendiente"
-			if task.Processed {
+			switch task.Status {
+			case models.StatusProcessed:
 				status = "✅ Procesada"
-			} else if task.ClaimedBy != "" {
+			case models.StatusRunning:
 				status = "🔄 En proceso"
+			case models.StatusDead:
+				status = "💀 Dead letter"
+			case models.StatusCancelled:
+				status = "🚫 Cancelada"
+			case models.StatusExpired:
+				status = "⌛ Expirada"
 			}
 			fmt.Printf("   %d. [%s] %s\n", i+1, status, task.Title)
 		}
 	}
 
 	fmt.Println("\n✨ Prueba completada!")
+
+	// 5. Iniciar worker pool
+	appCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	workerRepo := repository.NewWorkerRepository(mongoDB.GetCollection("workers"))
+	webhookRepo := repository.NewWebhookRepository(mongoDB.GetCollection("webhook_deliveries"))
+	breakerRepo := repository.NewBreakerRepository(mongoDB.GetCollection("circuit_breakers"))
+
+	pool := service.NewWorkerPool(taskRepo, workerRepo, breakerRepo, service.PoolConfig{
+		WorkerCount:   cfg.WorkerCount,
+		MinWorkers:    cfg.WorkerMin,
+		MaxWorkers:    cfg.WorkerMax,
+		Queues:        cfg.WorkerQueues,
+		Tags:          cfg.WorkerTags,
+		ChangeStreams: cfg.ChangeStreams,
+	})
+	pool.SetEventBus(bus)
+	smtpConfig := handlers.SMTPConfig{
+		Host:     cfg.SMTPHost,
+		Port:     cfg.SMTPPort,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+		From:     cfg.SMTPFrom,
+	}
+	thumbnailDir := filepath.Join(cfg.OutputDir, "thumbnails")
+	reportDir := filepath.Join(cfg.OutputDir, "reports")
+
+	pool.RegisterWithOptions("send_email", handlers.NewSendEmailHandler(smtpConfig), service.HandlerOptions{
+		Timeout:          30 * time.Second,
+		BreakerThreshold: 5,
+		BreakerCooldown:  time.Minute,
+	})
+	pool.RegisterWithOptions("process_image", withReport(handlers.NewProcessImageHandler(handlers.ImageConfig{
+		OutputDir: thumbnailDir,
+		InputDir:  cfg.ImageInputDir,
+	})), service.HandlerOptions{Timeout: 2 * time.Minute})
+	pool.RegisterWithOptions("generate_report", handlers.NewGenerateReportHandler(taskRepo, reportDir), service.HandlerOptions{Timeout: 10 * time.Minute})
+	pool.RegisterWithOptions("exec", handlers.NewExecHandler(handlers.ExecConfig{
+		Commands:  cfg.ExecCommands,
+		MaxOutput: cfg.ExecMaxOutput,
+	}), service.HandlerOptions{Timeout: 5 * time.Minute})
+	// Los receptores verifican la firma: sin clave este proceso no entrega webhooks
+	// (las tareas con callback_url quedan a la espera de una réplica que sí la tenga)
+	webhooksEnabled := cfg.WebhookSecret != ""
+	if webhooksEnabled {
+		pool.RegisterWithOptions(models.TypeWebhook, handlers.NewWebhookHandler(taskRepo, webhookRepo, handlers.WebhookConfig{
+			Secret: cfg.WebhookSecret,
+		}), service.HandlerOptions{
+			Timeout:         30 * time.Second,
+			RetryBackoff:    10 * time.Second,
+			MaxRetryBackoff: 10 * time.Minute,
+		})
+	} else {
+		log.Printf("⚠️  %v", handlers.ErrWebhookSecretMissing)
+	}
+	if err := pool.Start(appCtx); err != nil {
+		log.Fatalf("❌ Error al iniciar el worker pool: %v", err)
+	}
+
+	// Los componentes de mantenimiento corren en un solo proceso aunque haya varias
+	// réplicas: cada uno tiene su lease de liderazgo
+	leaseRepo := repository.NewLeaseRepository(mongoDB.GetCollection("leader_leases"))
+	elector := service.NewLeaderElector(leaseRepo, pool.ID(), 15*time.Second)
+
+	// Reaper: libera tareas de pools sin heartbeat y leases vencidos
+	reaper := service.NewReaper(taskRepo, workerRepo, 15*time.Second, 30*time.Second)
+	go elector.RunAsLeader(appCtx, "reaper", reaper.Run)
+
+	// Webhooks: encola la entrega para las tareas con callback_url que terminaron
+	if webhooksEnabled {
+		dispatcher := service.NewCallbackDispatcher(taskRepo, 2*time.Second)
+		go elector.RunAsLeader(appCtx, "callback_dispatcher", dispatcher.Run)
+	}
+
+	// Vencimientos: tareas pendientes que pasaron su expires_at
+	sweeper := service.NewExpirySweeper(taskRepo, 30*time.Second)
+	go elector.RunAsLeader(appCtx, "expiry_sweeper", sweeper.Run)
+
+	// Eventos en vivo: trae del historial lo que hacen otros procesos.
+	// Corre en todas las réplicas: cada una sirve sus propios streams SSE.
+	poller := service.NewEventPoller(taskRepo, bus, 2*time.Second)
+	go poller.Run(appCtx)
+
+	// 6. Iniciar servidor HTTP
+	taskHandler := transport.NewTaskHandler(taskRepo)
+	pauseHandler := transport.NewPauseHandler(pauseRepo)
+	workerHandler := transport.NewWorkerHandler(workerRepo)
+	webhookHandler := transport.NewWebhookHandler(webhookRepo)
+	streamHandler := transport.NewStreamHandler(bus)
+	metricsHandler := transport.NewMetricsHandler(pool.Metrics())
+	dashboardHandler := transport.NewDashboardHandler(taskRepo, pauseRepo)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /tasks", taskHandler.HandleSearchTasks)
+	mux.HandleFunc("POST /tasks", taskHandler.HandleCreateTask)
+	mux.HandleFunc("GET /tasks/stream", streamHandler.HandleStream)
+	mux.HandleFunc("GET /tasks/{id}", taskHandler.HandleGetTask)
+	mux.HandleFunc("GET /tasks/{id}/events", taskHandler.HandleTaskEvents)
+	mux.HandleFunc("GET /tasks/{id}/webhooks", webhookHandler.HandleListDeliveries)
+	mux.HandleFunc("POST /tasks/{id}/retry", taskHandler.HandleRetryTask)
+	mux.HandleFunc("POST /tasks/{id}/cancel", taskHandler.HandleCancelTask)
+	mux.HandleFunc("GET /stats", taskHandler.HandleStats)
+	mux.HandleFunc("GET /pauses", pauseHandler.HandleListPauses)
+	mux.HandleFunc("POST /pauses", pauseHandler.HandlePause)
+	mux.HandleFunc("DELETE /pauses/{kind}/{name}", pauseHandler.HandleResume)
+	mux.HandleFunc("GET /workers", workerHandler.HandleListWorkers)
+	mux.HandleFunc("GET /metrics", metricsHandler.HandleMetrics)
+	mux.HandleFunc("GET /dashboard", dashboardHandler.HandleDashboard)
+	mux.HandleFunc("GET /dashboard/tasks/{id}", dashboardHandler.HandleTaskDetail)
+	mux.HandleFunc("POST /dashboard/tasks/{id}/{action}", dashboardHandler.HandleTaskAction)
+	mux.HandleFunc("POST /dashboard/pauses/{action}", dashboardHandler.HandlePauseAction)
+
+	server := &http.Server{Addr: ":" + cfg.ServerPort, Handler: mux}
+	server.RegisterOnShutdown(bus.Close) // Shutdown no espera a los streams SSE
+	go func() {
+		log.Printf("🌐 Servidor iniciado en http://localhost:%s", cfg.ServerPort)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("❌ Error del servidor HTTP: %v", err)
+		}
+	}()
+
+	// 7. Esperar Ctrl+C / SIGTERM y apagar en orden
+	<-appCtx.Done()
+	log.Println("🛑 Deteniendo Task Processor...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	server.Shutdown(shutdownCtx)
+	pool.Stop()
+}
+
+// withReport encola un "Generar reporte" como continuación de las tareas exitosas
+// que lo piden con "report": true en el payload
+func withReport(handler service.Handler) service.Handler {
+	return func(ctx context.Context, task *models.Task) (service.Result, error) {
+		result, err := handler(ctx, task)
+		if err != nil {
+			return result, err
+		}
+		if wanted, _ := task.Payload["report"].(bool); !wanted {
+			return result, nil
+		}
+		report := models.NewTask("generate_report", "Generar reporte", map[string]interface{}{
+			"report_type": "image",
+			"source_task": task.ID.Hex(),
+		})
+		result.Children = append(result.Children, report)
+		return result, nil
+	}
 }
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Estados del circuit breaker de un tipo de tarea
+const (
+	BreakerClosed   = "closed"    // Normal: se reclaman tareas del tipo
+	BreakerOpen     = "open"      // Demasiados fallos seguidos: no se reclaman tareas del tipo
+	BreakerHalfOpen = "half_open" // Pasó el cooldown: una sola tarea de prueba en curso
+)
+
+// CircuitBreaker estado del circuit breaker de un tipo de tarea
+type CircuitBreaker struct {
+	Type                string     `bson:"_id" json:"type"`
+	State               string     `bson:"state" json:"state"`
+	ConsecutiveFailures int        `bson:"failures" json:"consecutive_failures"`
+	OpenedAt            *time.Time `bson:"opened_at,omitempty" json:"opened_at,omitempty"`
+	RetryAt             *time.Time `bson:"retry_at,omitempty" json:"retry_at,omitempty"` // Cuándo se permite la próxima tarea de prueba
+}
+
+// Blocks indica si el breaker impide reclamar tareas de su tipo en este momento
+func (b *CircuitBreaker) Blocks(now time.Time) bool {
+	if b.State == BreakerClosed || b.State == "" {
+		return false
+	}
+	return b.RetryAt == nil || b.RetryAt.After(now)
+}
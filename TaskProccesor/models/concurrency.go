@@ -0,0 +1,11 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// ConcurrencySlot tareas en ejecución de una clave de concurrencia.
+// Holders tiene como máximo Limit elementos.
+type ConcurrencySlot struct {
+	Key     string               `bson:"_id" json:"key"`
+	Limit   int                  `bson:"limit" json:"limit"`
+	Holders []primitive.ObjectID `bson:"holders" json:"holders"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// LeaderLease documento de bloqueo de un componente que solo debe correr en un
+// proceso a la vez (reaper, sweepers, dispatcher). Quien lo tiene es el líder
+// mientras lo renueve antes de ExpiresAt.
+type LeaderLease struct {
+	Name       string    `bson:"_id" json:"name"`
+	Owner      string    `bson:"owner" json:"owner"`
+	AcquiredAt time.Time `bson:"acquired_at" json:"acquired_at"`
+	RenewedAt  time.Time `bson:"renewed_at" json:"renewed_at"`
+	ExpiresAt  time.Time `bson:"expires_at" json:"expires_at"`
+}
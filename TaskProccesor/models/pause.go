@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Tipos de pausa: por cola o por tipo de tarea
+const (
+	PauseKindQueue = "queue"
+	PauseKindType  = "type"
+)
+
+// Pause indica que no se deben reclamar tareas de una cola o de un tipo
+type Pause struct {
+	ID       string    `bson:"_id" json:"-"`
+	Kind     string    `bson:"kind" json:"kind"`
+	Name     string    `bson:"name" json:"name"`
+	Reason   string    `bson:"reason,omitempty" json:"reason,omitempty"`
+	PausedAt time.Time `bson:"paused_at" json:"paused_at"`
+}
+
+// PauseID identificador de la pausa de una cola o tipo (ej: "type:process_image")
+func PauseID(kind, name string) string {
+	return kind + ":" + name
+}
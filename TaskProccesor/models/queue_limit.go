@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// QueueLimit máximo de tareas pendientes de una cola o de un tipo. Kind es
+// PauseKindQueue o PauseKindType, igual que en Pause.
+type QueueLimit struct {
+	ID         string    `bson:"_id" json:"-"`
+	Kind       string    `bson:"kind" json:"kind"`
+	Name       string    `bson:"name" json:"name"`
+	MaxPending int64     `bson:"max_pending" json:"max_pending"`
+	UpdatedAt  time.Time `bson:"updated_at" json:"updated_at"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// RateLimit token bucket de un tipo de tarea, compartido por todos los procesos
+type RateLimit struct {
+	Type      string    `bson:"_id" json:"type"`
+	Rate      float64   `bson:"rate" json:"rate"`   // Tokens que se recargan por segundo
+	Burst     float64   `bson:"burst" json:"burst"` // Máximo de tokens acumulables
+	Tokens    float64   `bson:"tokens" json:"tokens"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// Available tokens disponibles en now, contando la recarga desde la última actualización
+func (l *RateLimit) Available(now time.Time) float64 {
+	elapsed := math.Max(0, now.Sub(l.UpdatedAt).Seconds())
+	return math.Min(l.Burst, l.Tokens+elapsed*l.Rate)
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// TaskStats resumen de la cola de tareas
+type TaskStats struct {
+	Total      int64                 `json:"total"`
+	ByStatus   map[string]int64      `json:"by_status"`
+	ByType     map[string]int64      `json:"by_type"`
+	ByQueue    map[string]int64      `json:"by_queue"`
+	Paused     []*Pause              `json:"paused"`
+	Breakers   []*CircuitBreaker     `json:"circuit_breakers"`
+	RateLimits map[string]*RateLimit `json:"rate_limits"`
+}
+
+// WorkerActivity actividad de un worker según las tareas que reclamó
+type WorkerActivity struct {
+	WorkerID      string    `bson:"_id" json:"worker_id"`
+	Running       int64     `bson:"running" json:"running"`
+	Processed     int64     `bson:"processed" json:"processed"`
+	LastClaimedAt time.Time `bson:"last_claimed_at" json:"last_claimed_at"`
+}
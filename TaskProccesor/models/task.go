@@ -1,32 +1,125 @@
 package models
 
 import (
+	"encoding/json"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Estados posibles de una tarea
+const (
+	StatusPending   = "pending"   // Esperando a ser reclamada
+	StatusRunning   = "running"   // Reclamada por un worker
+	StatusProcessed = "processed" // Terminada con éxito
+	StatusDead      = "dead"      // Agotó sus intentos (dead letter)
+	StatusCancelled = "cancelled" // Cancelada antes de ejecutarse
+	StatusExpired   = "expired"   // Llegó a expires_at sin haberse ejecutado
+)
+
+// Statuses todos los estados, en el orden del ciclo de vida
+var Statuses = []string{StatusPending, StatusRunning, StatusProcessed, StatusDead, StatusCancelled, StatusExpired}
+
+// DefaultQueue cola a la que va una tarea si no se indica otra
+const DefaultQueue = "default"
+
+// DefaultMaxAttempts intentos por defecto antes de mandar la tarea a dead letter
+const DefaultMaxAttempts = 3
+
+// TypeWebhook tipo de las tareas que entregan el webhook de otra tarea terminada
+const TypeWebhook = "webhook"
+
+// WebhookMaxAttempts intentos de entrega de un webhook antes de darlo por perdido
+const WebhookMaxAttempts = 8
+
 type Task struct {
-	ID          primitive.ObjectID     `bson:"_id,omitempty" json:"id"`
-	Title       string                 `bson:"title" json:"title"`
-	Payload     map[string]interface{} `bson:"payload" json:"payload"`
-	Processed   bool                   `bson:"processed" json:"processed"`
-	Attempts    int                    `bson:"attempts" json:"attempts"`
-	ClaimedBy   string                 `bson:"claimed_by,omitempty" json:"claimed_by,omitempty"`
-	ClaimedAt   *primitive.DateTime    `bson:"claimed_at,omitempty" json:"claimed_at,omitempty"`
-	ProcessedAt *primitive.DateTime    `bson:"processed_at,omitempty" json:"processed_at,omitempty"`
-	Result      string                 `bson:"result,omitempty" json:"result,omitempty"`
-	CreatedAt   time.Time              `bson:"created_at" json:"created_at"`
+	ID              primitive.ObjectID     `bson:"_id,omitempty" json:"id"`
+	Type            string                 `bson:"type" json:"type"`
+	Queue           string                 `bson:"queue" json:"queue"`
+	Title           string                 `bson:"title" json:"title"`
+	Payload         map[string]interface{} `bson:"payload" json:"payload"`
+	Status          string                 `bson:"status" json:"status"`
+	Processed       bool                   `bson:"processed" json:"processed"`
+	Attempts        int                    `bson:"attempts" json:"attempts"`
+	MaxAttempts     int                    `bson:"max_attempts" json:"max_attempts"`
+	TimeoutSeconds  int                    `bson:"timeout_seconds,omitempty" json:"timeout_seconds,omitempty"` // Máximo por intento (0 = el del tipo)
+	ConcurrencyKey  string                 `bson:"concurrency_key,omitempty" json:"concurrency_key,omitempty"` // Tareas con la misma clave no corren más de MaxConcurrency a la vez
+	MaxConcurrency  int                    `bson:"max_concurrency,omitempty" json:"max_concurrency,omitempty"`
+	RequiredTags    []string               `bson:"required_tags,omitempty" json:"required_tags,omitempty"` // Solo la reclaman pools que ofrecen todas estas tags
+	RunAt           *time.Time             `bson:"run_at,omitempty" json:"run_at,omitempty"`               // No se reclama antes (backoff entre reintentos)
+	ExpiresAt       *time.Time             `bson:"expires_at,omitempty" json:"expires_at,omitempty"`       // Si sigue pendiente a esta hora ya no se ejecuta (pasa a expired)
+	CallbackURL     string                 `bson:"callback_url,omitempty" json:"callback_url,omitempty"`   // Recibe un POST al terminar la tarea
+	CallbackStatus  string                 `bson:"callback_status,omitempty" json:"-"`                     // Último estado terminal cuyo webhook ya se encoló
+	ClaimedBy       string                 `bson:"claimed_by,omitempty" json:"claimed_by,omitempty"`
+	ClaimedAt       *primitive.DateTime    `bson:"claimed_at,omitempty" json:"claimed_at,omitempty"`
+	ClaimID         primitive.ObjectID     `bson:"claim_id,omitempty" json:"-"`
+	LeaseUntil      *primitive.DateTime    `bson:"lease_until,omitempty" json:"lease_until,omitempty"`
+	ProcessedAt     *primitive.DateTime    `bson:"processed_at,omitempty" json:"processed_at,omitempty"`
+	Result          string                 `bson:"result,omitempty" json:"result,omitempty"`
+	LastError       string                 `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	LastErrorStack  string                 `bson:"last_error_stack,omitempty" json:"last_error_stack,omitempty"` // Stack trace si el intento terminó en panic
+	FailedAt        *primitive.DateTime    `bson:"failed_at,omitempty" json:"failed_at,omitempty"`
+	Progress        *TaskProgress          `bson:"progress,omitempty" json:"progress,omitempty"`
+	Checkpoint      *TaskCheckpoint        `bson:"checkpoint,omitempty" json:"checkpoint,omitempty"` // Estado para retomar en el próximo intento
+	ParentID        *primitive.ObjectID    `bson:"parent_id,omitempty" json:"parent_id,omitempty"`   // Tarea que encoló esta como continuación
+	PendingChildren []*Task                `bson:"pending_children,omitempty" json:"-"`              // Hijas aún no insertadas (ver CompleteWithChildren)
+	Events          []TaskEvent            `bson:"events,omitempty" json:"-"`                        // Historial (ver GET /tasks/{id}/events)
+	CreatedAt       time.Time              `bson:"created_at" json:"created_at"`
+}
+
+// TaskProgress progreso reportado por el handler mientras procesa la tarea.
+// El estado para retomar un intento va en Task.Checkpoint (ver service.SaveCheckpoint).
+type TaskProgress struct {
+	Percent   int       `bson:"percent" json:"percent"`
+	Message   string    `bson:"message,omitempty" json:"message,omitempty"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// TaskCheckpoint estado que el handler guardó para que el próximo intento retome
+// desde ahí en vez de empezar de cero. Data es opaco para el procesador.
+type TaskCheckpoint struct {
+	Data    json.RawMessage `bson:"data" json:"data"`
+	Attempt int             `bson:"attempt" json:"attempt"` // Intento que lo guardó
+	SavedAt time.Time       `bson:"saved_at" json:"saved_at"`
 }
 
 // Creat tarea
-func NewTask(title string, payload map[string]interface{}) *Task {
+func NewTask(taskType, title string, payload map[string]interface{}) *Task {
 	return &Task{
-		ID:        primitive.NewObjectID(),
-		Title:     title,
-		Payload:   payload,
-		Processed: false,
-		Attempts:  0,
-		CreatedAt: time.Now(),
+		ID:          primitive.NewObjectID(),
+		Type:        taskType,
+		Queue:       DefaultQueue,
+		Title:       title,
+		Payload:     payload,
+		Status:      StatusPending,
+		Processed:   false,
+		Attempts:    0,
+		MaxAttempts: DefaultMaxAttempts,
+		CreatedAt:   time.Now(),
+	}
+}
+
+// NormalizeTags quita espacios, vacíos y repetidas de una lista de tags
+// (ej: required_tags de una tarea o WORKER_TAGS). Retorna nil si no queda ninguna.
+func NormalizeTags(tags []string) []string {
+	var normalized []string
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
 	}
+	return normalized
+}
+
+// TerminalStatuses estados en los que la tarea ya no vuelve a ejecutarse
+var TerminalStatuses = []string{StatusProcessed, StatusDead, StatusCancelled, StatusExpired}
+
+// IsTerminal indica si la tarea ya no va a volver a ejecutarse
+func (t *Task) IsTerminal() bool {
+	return t.Status == StatusProcessed || t.Status == StatusDead || t.Status == StatusCancelled || t.Status == StatusExpired
 }
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Tipos de evento del historial de una tarea
+const (
+	EventCreated       = "created"        // Se encoló la tarea
+	EventClaimed       = "claimed"        // Un worker la reclamó
+	EventLeaseExtended = "lease_extended" // El worker extendió su lease
+	EventFailed        = "failed"         // Un intento falló; Status dice si vuelve a pending o pasa a dead
+	EventRetried       = "retried"        // Se re-encoló a mano (retry / requeue-dead)
+	EventSucceeded     = "succeeded"      // Terminó con éxito
+	EventCancelled     = "cancelled"      // Se canceló antes de ejecutarse
+	EventExpired       = "expired"        // Venció expires_at antes de ejecutarse
+)
+
+// TaskEvent entrada del historial de una tarea. El historial solo crece.
+type TaskEvent struct {
+	Type     string    `bson:"type" json:"type"`
+	At       time.Time `bson:"at" json:"at"`
+	WorkerID string    `bson:"worker_id,omitempty" json:"worker_id,omitempty"`
+	Attempt  int       `bson:"attempt,omitempty" json:"attempt,omitempty"`
+	Status   string    `bson:"status,omitempty" json:"status,omitempty"` // Estado en que quedó la tarea
+	Message  string    `bson:"message,omitempty" json:"message,omitempty"`
+}
+
+// NewTaskEvent crea un evento con la hora actual
+func NewTaskEvent(eventType, workerID, message string) TaskEvent {
+	return TaskEvent{Type: eventType, At: time.Now(), WorkerID: workerID, Message: message}
+}
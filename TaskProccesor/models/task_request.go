@@ -0,0 +1,54 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// TaskRequest datos con los que se encola una tarea (cuerpo de POST /tasks y
+// JSON de "taskctl enqueue")
+type TaskRequest struct {
+	Type           string                 `json:"type"`
+	Title          string                 `json:"title"`
+	Queue          string                 `json:"queue"`
+	Payload        map[string]interface{} `json:"payload"`
+	MaxAttempts    int                    `json:"max_attempts"`
+	TimeoutSeconds int                    `json:"timeout_seconds"`
+	ConcurrencyKey string                 `json:"concurrency_key"`
+	MaxConcurrency int                    `json:"max_concurrency"`
+	RequiredTags   []string               `json:"required_tags"`
+	CallbackURL    string                 `json:"callback_url"`
+	ExpiresAt      *time.Time             `json:"expires_at"`
+}
+
+// NewTask valida el pedido y arma la tarea pendiente. Los campos vacíos toman
+// los valores por defecto de NewTask.
+func (req TaskRequest) NewTask() (*Task, error) {
+	if req.Type == "" || req.Title == "" {
+		return nil, fmt.Errorf("los campos type y title son obligatorios")
+	}
+	if req.CallbackURL != "" {
+		if parsed, err := url.Parse(req.CallbackURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("callback_url inválida: %s", req.CallbackURL)
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("expires_at ya pasó: %s", req.ExpiresAt.Format(time.RFC3339))
+	}
+
+	task := NewTask(req.Type, req.Title, req.Payload)
+	if req.Queue != "" {
+		task.Queue = req.Queue
+	}
+	if req.MaxAttempts > 0 {
+		task.MaxAttempts = req.MaxAttempts
+	}
+	task.TimeoutSeconds = req.TimeoutSeconds
+	task.ConcurrencyKey = req.ConcurrencyKey
+	task.MaxConcurrency = req.MaxConcurrency
+	task.RequiredTags = NormalizeTags(req.RequiredTags)
+	task.CallbackURL = req.CallbackURL
+	task.ExpiresAt = req.ExpiresAt
+	return task, nil
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTaskRequestValidation(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	tests := map[string]struct {
+		request TaskRequest
+		err     string
+	}{
+		"sin tipo":             {TaskRequest{Title: "Email"}, "obligatorios"},
+		"sin título":           {TaskRequest{Type: "send_email"}, "obligatorios"},
+		"callback sin esquema": {TaskRequest{Type: "send_email", Title: "Email", CallbackURL: "example.com/hook"}, "callback_url"},
+		"callback ftp":         {TaskRequest{Type: "send_email", Title: "Email", CallbackURL: "ftp://example.com/hook"}, "callback_url"},
+		"expires_at pasado":    {TaskRequest{Type: "send_email", Title: "Email", ExpiresAt: &past}, "expires_at"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			task, err := test.request.NewTask()
+			if err == nil || !strings.Contains(err.Error(), test.err) || task != nil {
+				t.Errorf("error = %v, se esperaba uno sobre %s", err, test.err)
+			}
+		})
+	}
+}
+
+func TestTaskRequestNewTask(t *testing.T) {
+	expires := time.Now().Add(time.Hour)
+	task, err := TaskRequest{
+		Type:         "send_email",
+		Title:        "Email",
+		RequiredTags: []string{" region:eu ", "", "region:eu"},
+		CallbackURL:  "https://example.com/hook",
+		ExpiresAt:    &expires,
+	}.NewTask()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Status != StatusPending || task.Queue != DefaultQueue || task.MaxAttempts != DefaultMaxAttempts {
+		t.Errorf("valores por defecto: status %q, queue %q, max_attempts %d", task.Status, task.Queue, task.MaxAttempts)
+	}
+	if len(task.RequiredTags) != 1 || task.RequiredTags[0] != "region:eu" || task.CallbackURL != "https://example.com/hook" || task.ExpiresAt != &expires {
+		t.Errorf("tarea = %+v", task)
+	}
+}
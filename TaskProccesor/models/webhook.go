@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// WebhookDelivery registro de un intento de entrega del webhook de una tarea
+type WebhookDelivery struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TaskID         primitive.ObjectID `bson:"task_id" json:"task_id"`                   // Tarea notificada
+	DeliveryTaskID primitive.ObjectID `bson:"delivery_task_id" json:"delivery_task_id"` // Tarea "webhook" que hizo la entrega
+	URL            string             `bson:"url" json:"url"`
+	TaskStatus     string             `bson:"task_status" json:"task_status"`
+	Attempt        int                `bson:"attempt" json:"attempt"`
+	StatusCode     int                `bson:"status_code,omitempty" json:"status_code,omitempty"`
+	Error          string             `bson:"error,omitempty" json:"error,omitempty"`
+	Success        bool               `bson:"success" json:"success"`
+	DurationMs     int64              `bson:"duration_ms" json:"duration_ms"`
+	DeliveredAt    time.Time          `bson:"delivered_at" json:"delivered_at"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Worker registro de un pool de workers en ejecución
+type Worker struct {
+	ID            string        `bson:"_id" json:"id"`
+	Hostname      string        `bson:"hostname" json:"hostname"`
+	PID           int           `bson:"pid" json:"pid"`
+	Concurrency   int           `bson:"concurrency" json:"concurrency"`
+	Queues        []string      `bson:"queues" json:"queues"`
+	Tags          []string      `bson:"tags,omitempty" json:"tags,omitempty"`
+	StartedAt     time.Time     `bson:"started_at" json:"started_at"`
+	LastHeartbeat time.Time     `bson:"last_heartbeat" json:"last_heartbeat"`
+	Running       []RunningTask `bson:"running" json:"running"`
+}
+
+// RunningTask tarea que un worker del pool está procesando
+type RunningTask struct {
+	WorkerID  string             `bson:"worker_id" json:"worker_id"`
+	TaskID    primitive.ObjectID `bson:"task_id" json:"task_id"`
+	Type      string             `bson:"type" json:"type"`
+	StartedAt time.Time          `bson:"started_at" json:"started_at"`
+}
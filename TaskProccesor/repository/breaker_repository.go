@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"taskProcessor/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BreakerRepository guarda el estado de los circuit breakers por tipo de tarea,
+// compartido por todos los procesos que usan la misma base de datos
+type BreakerRepository struct {
+	collection *mongo.Collection
+}
+
+func NewBreakerRepository(collection *mongo.Collection) *BreakerRepository {
+	return &BreakerRepository{
+		collection: collection,
+	}
+}
+
+// List retorna los breakers de todos los tipos que alguna vez fallaron
+func (r *BreakerRepository) List(ctx context.Context) ([]*models.CircuitBreaker, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	cursor, err := r.collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("error al listar circuit breakers: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	breakers := []*models.CircuitBreaker{}
+	if err = cursor.All(ctx, &breakers); err != nil {
+		return nil, fmt.Errorf("error al decodificar circuit breakers: %v", err)
+	}
+	return breakers, nil
+}
+
+// NotClosed retorna los breakers abiertos o half-open, indexados por tipo
+func (r *BreakerRepository) NotClosed(ctx context.Context) (map[string]*models.CircuitBreaker, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"state": bson.M{"$in": bson.A{models.BreakerOpen, models.BreakerHalfOpen}}}
+	cursor, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("error al listar circuit breakers: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var breakers []*models.CircuitBreaker
+	if err = cursor.All(ctx, &breakers); err != nil {
+		return nil, fmt.Errorf("error al decodificar circuit breakers: %v", err)
+	}
+
+	byType := make(map[string]*models.CircuitBreaker, len(breakers))
+	for _, breaker := range breakers {
+		byType[breaker.Type] = breaker
+	}
+	return byType, nil
+}
+
+// RecordSuccess cierra el breaker del tipo y reinicia el conteo de fallos
+func (r *BreakerRepository) RecordSuccess(ctx context.Context, taskType string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$set":   bson.M{"state": models.BreakerClosed, "failures": 0},
+		"$unset": bson.M{"opened_at": "", "retry_at": ""},
+	}
+	if _, err := r.collection.UpdateOne(ctx, bson.M{"_id": taskType}, update); err != nil {
+		return fmt.Errorf("error al registrar éxito en circuit breaker: %v", err)
+	}
+	return nil
+}
+
+// RecordFailure suma un fallo consecutivo. El breaker se abre al llegar a threshold
+// fallos, o inmediatamente si falló la tarea de prueba (half-open).
+func (r *BreakerRepository) RecordFailure(ctx context.Context, taskType string, threshold int, cooldown time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	isOpen := bson.M{"$eq": bson.A{"$state", models.BreakerOpen}}
+	trip := bson.M{"$and": bson.A{
+		bson.M{"$not": bson.A{isOpen}},
+		bson.M{"$or": bson.A{
+			bson.M{"$eq": bson.A{"$state", models.BreakerHalfOpen}},
+			bson.M{"$gte": bson.A{"$failures", threshold}},
+		}},
+	}}
+
+	// Pipeline: primero se incrementa el contador, después se decide si abrir
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"failures": bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$failures", 0}}, 1}},
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"state":     bson.M{"$cond": bson.A{trip, models.BreakerOpen, bson.M{"$ifNull": bson.A{"$state", models.BreakerClosed}}}},
+			"opened_at": bson.M{"$cond": bson.A{trip, now, "$opened_at"}},
+			"retry_at":  bson.M{"$cond": bson.A{trip, now.Add(cooldown), "$retry_at"}},
+		}}},
+	}
+
+	opts := options.Update().SetUpsert(true)
+	if _, err := r.collection.UpdateOne(ctx, bson.M{"_id": taskType}, update, opts); err != nil {
+		return fmt.Errorf("error al registrar fallo en circuit breaker: %v", err)
+	}
+	return nil
+}
+
+// AcquireProbe intenta pasar el breaker de un tipo a half-open para ejecutar una
+// tarea de prueba. Solo un worker lo consigue; el resto sigue viendo el tipo bloqueado
+// hasta que el probe termine o pase otro cooldown.
+func (r *BreakerRepository) AcquireProbe(ctx context.Context, taskType string, probeTimeout time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{
+		"_id":      taskType,
+		"state":    bson.M{"$in": bson.A{models.BreakerOpen, models.BreakerHalfOpen}},
+		"retry_at": bson.M{"$lte": now},
+	}
+	update := bson.M{"$set": bson.M{
+		"state":    models.BreakerHalfOpen,
+		"retry_at": now.Add(probeTimeout),
+	}}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, fmt.Errorf("error al adquirir probe del circuit breaker: %v", err)
+	}
+	return result.ModifiedCount > 0, nil
+}
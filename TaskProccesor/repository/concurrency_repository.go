@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"taskProcessor/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ConcurrencyRepository slots de las claves de concurrencia. Cada clave es un
+// documento con las tareas que la ocupan; tomar un slot es un update condicional
+// sobre ese documento, así el límite se respeta entre todos los procesos.
+type ConcurrencyRepository struct {
+	collection *mongo.Collection
+}
+
+func NewConcurrencyRepository(collection *mongo.Collection) *ConcurrencyRepository {
+	return &ConcurrencyRepository{
+		collection: collection,
+	}
+}
+
+// Acquire ocupa un slot de key para la tarea si hay menos de limit ocupados.
+// Es idempotente: si la tarea ya tenía el slot retorna true.
+func (r *ConcurrencyRepository) Acquire(ctx context.Context, key string, limit int, taskID primitive.ObjectID) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if limit < 1 {
+		limit = 1
+	}
+
+	// holders.<limit-1> no existe = hay menos de limit tareas ocupando la clave
+	filter := bson.M{
+		"_id": key,
+		"$or": bson.A{
+			bson.M{"holders": taskID},
+			bson.M{"holders." + strconv.Itoa(limit-1): bson.M{"$exists": false}},
+		},
+	}
+	update := bson.M{
+		"$set":      bson.M{"limit": limit},
+		"$addToSet": bson.M{"holders": taskID},
+	}
+
+	_, err := r.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		// La clave existe pero está llena: el upsert intenta insertar el mismo _id
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error al ocupar slot de concurrencia %s: %v", key, err)
+	}
+	return true, nil
+}
+
+// Release libera el slot que ocupa la tarea, si tiene alguno
+func (r *ConcurrencyRepository) Release(ctx context.Context, taskID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	update := bson.M{"$pull": bson.M{"holders": taskID}}
+	if _, err := r.collection.UpdateMany(ctx, bson.M{"holders": taskID}, update); err != nil {
+		return fmt.Errorf("error al liberar slot de concurrencia: %v", err)
+	}
+	return nil
+}
+
+// Saturated retorna las claves que tienen todos sus slots ocupados
+func (r *ConcurrencyRepository) Saturated(ctx context.Context) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"$expr": bson.M{"$gte": bson.A{bson.M{"$size": "$holders"}, "$limit"}}}
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("error al buscar claves de concurrencia llenas: %v", err)
+	}
+	var slots []struct {
+		Key string `bson:"_id"`
+	}
+	if err = cursor.All(ctx, &slots); err != nil {
+		return nil, fmt.Errorf("error al decodificar claves de concurrencia: %v", err)
+	}
+
+	keys := make([]string, len(slots))
+	for i, slot := range slots {
+		keys[i] = slot.Key
+	}
+	return keys, nil
+}
+
+// InUse retorna las claves con al menos un slot ocupado
+func (r *ConcurrencyRepository) InUse(ctx context.Context) ([]*models.ConcurrencySlot, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"holders.0": bson.M{"$exists": true}}
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("error al listar claves de concurrencia: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	slots := []*models.ConcurrencySlot{}
+	if err = cursor.All(ctx, &slots); err != nil {
+		return nil, fmt.Errorf("error al decodificar claves de concurrencia: %v", err)
+	}
+	return slots, nil
+}
+
+// Remove quita taskIDs de los slots que ocupan
+func (r *ConcurrencyRepository) Remove(ctx context.Context, taskIDs []primitive.ObjectID) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if len(taskIDs) == 0 {
+		return 0, nil
+	}
+	filter := bson.M{"holders": bson.M{"$in": taskIDs}}
+	update := bson.M{"$pull": bson.M{"holders": bson.M{"$in": taskIDs}}}
+	result, err := r.collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, fmt.Errorf("error al liberar slots de concurrencia: %v", err)
+	}
+	return result.ModifiedCount, nil
+}
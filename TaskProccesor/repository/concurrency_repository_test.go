@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"taskProcessor/models"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestConcurrencyAcquireLimitOne(t *testing.T) {
+	repo := testRepository(t)
+	slots := repo.concurrency
+	ctx := context.Background()
+	const key = "report:user:12345"
+
+	ids := []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID()}
+	acquired := make([]bool, len(ids))
+	errs := make([]error, len(ids))
+
+	// Los dos compiten por el único slot a la vez
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			acquired[i], errs[i] = slots.Acquire(ctx, key, 1, id)
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if acquired[0] == acquired[1] {
+		t.Fatalf("exactamente uno debe ocupar el slot, resultado: %v", acquired)
+	}
+	winner, loser := ids[0], ids[1]
+	if acquired[1] {
+		winner, loser = ids[1], ids[0]
+	}
+
+	// Acquire es idempotente para el dueño y sigue fallando para el otro
+	if ok, err := slots.Acquire(ctx, key, 1, winner); err != nil || !ok {
+		t.Errorf("el dueño debe conservar el slot: %v, %v", ok, err)
+	}
+	if ok, err := slots.Acquire(ctx, key, 1, loser); err != nil || ok {
+		t.Errorf("la clave está llena: %v, %v", ok, err)
+	}
+	saturated, err := slots.Saturated(ctx)
+	if err != nil || len(saturated) != 1 || saturated[0] != key {
+		t.Errorf("Saturated = %v, %v", saturated, err)
+	}
+
+	// Al liberar, el otro puede ocuparlo
+	if err := slots.Release(ctx, winner); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := slots.Acquire(ctx, key, 1, loser); err != nil || !ok {
+		t.Errorf("tras Release el slot debe quedar libre: %v, %v", ok, err)
+	}
+}
+
+func TestClaimRespectsConcurrencyKey(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		task := models.NewTask("generate_report", "Reporte", nil)
+		task.ConcurrencyKey = "report:user:12345"
+		task.MaxConcurrency = 1
+		if err := repo.Create(ctx, task); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Dos workers reclaman a la vez: solo uno puede llevarse una tarea de la clave
+	workers := []string{"worker-a", "worker-b"}
+	claimed := make([]*models.Task, len(workers))
+	errs := make([]error, len(workers))
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i, workerID := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			claimed[i], errs[i] = repo.ClaimTask(ctx, workerID)
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if (claimed[0] == nil) == (claimed[1] == nil) {
+		t.Fatalf("exactamente un worker debe reclamar una tarea: %v", claimed)
+	}
+	winner, loser := 0, 1
+	if claimed[1] != nil {
+		winner, loser = 1, 0
+	}
+	task := claimed[winner]
+
+	// El perdedor no consigue nada mientras el slot esté ocupado, y la tarea que
+	// devolvió a la cola no cuenta como intento
+	if again, err := repo.ClaimTask(ctx, workers[loser]); err != nil || again != nil {
+		t.Fatalf("la clave está llena, se reclamó %v (%v)", again, err)
+	}
+	pending, err := repo.FindByStatusAndType(ctx, models.StatusPending, "", 0)
+	if err != nil || len(pending) != 1 || pending[0].Attempts != 0 || pending[0].ClaimedBy != "" {
+		t.Fatalf("la otra tarea debe seguir pendiente sin intentos: %+v (%v)", pending, err)
+	}
+
+	// Al terminar la primera, el slot se libera y la segunda se puede reclamar
+	if err := repo.MarkAsProcessed(ctx, task.ID, workers[winner], "ok"); err != nil {
+		t.Fatal(err)
+	}
+	next, err := repo.ClaimTask(ctx, workers[loser])
+	if err != nil || next == nil || next.ID != pending[0].ID {
+		t.Fatalf("tras liberar el slot se esperaba reclamar %s, se obtuvo %v (%v)", pending[0].ID.Hex(), next, err)
+	}
+}
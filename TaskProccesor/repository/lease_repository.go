@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"taskProcessor/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LeaseRepository leases de liderazgo: un documento por componente con el dueño
+// y hasta cuándo vale. Tomarlo o renovarlo es un update condicional, así solo un
+// proceso lo tiene a la vez.
+type LeaseRepository struct {
+	collection *mongo.Collection
+}
+
+func NewLeaseRepository(collection *mongo.Collection) *LeaseRepository {
+	return &LeaseRepository{
+		collection: collection,
+	}
+}
+
+// Acquire toma el lease name para owner durante ttl, o lo renueva si ya era suyo.
+// Retorna false si lo tiene otro proceso y todavía no venció.
+func (r *LeaseRepository) Acquire(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{
+		"_id": name,
+		"$or": bson.A{
+			bson.M{"owner": owner},
+			bson.M{"expires_at": bson.M{"$lte": now}},
+		},
+	}
+	// acquired_at solo cambia cuando cambia el dueño
+	update := bson.A{
+		bson.M{"$set": bson.M{
+			"acquired_at": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$owner", owner}}, "$acquired_at", now,
+			}},
+			"owner":      owner,
+			"renewed_at": now,
+			"expires_at": now.Add(ttl),
+		}},
+	}
+
+	_, err := r.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		// El lease existe, es de otro y no venció: el upsert intenta insertar el mismo _id
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error al tomar el lease %s: %v", name, err)
+	}
+	return true, nil
+}
+
+// Release libera el lease si sigue siendo de owner, para que otro proceso lo tome
+// sin esperar a que venza
+func (r *LeaseRepository) Release(ctx context.Context, name, owner string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if _, err := r.collection.DeleteOne(ctx, bson.M{"_id": name, "owner": owner}); err != nil {
+		return fmt.Errorf("error al liberar el lease %s: %v", name, err)
+	}
+	return nil
+}
+
+// List retorna los leases vigentes, ordenados por nombre
+func (r *LeaseRepository) List(ctx context.Context) ([]*models.LeaderLease, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"expires_at": bson.M{"$gt": time.Now()}}
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("error al listar leases: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	leases := []*models.LeaderLease{}
+	if err = cursor.All(ctx, &leases); err != nil {
+		return nil, fmt.Errorf("error al decodificar leases: %v", err)
+	}
+	return leases, nil
+}
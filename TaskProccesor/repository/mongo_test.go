@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// testRepository repositorio sobre una base de datos descartable en el MongoDB de
+// TEST_MONGODB_URI (ej: mongodb://localhost:27017). Sin esa variable el test se omite.
+func testRepository(t *testing.T) *TaskRepository {
+	t.Helper()
+	uri := os.Getenv("TEST_MONGODB_URI")
+	if uri == "" {
+		t.Skip("TEST_MONGODB_URI no está configurado: se omiten los tests contra MongoDB")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("error al conectar a MongoDB: %v", err)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		t.Fatalf("error al hacer ping a MongoDB: %v", err)
+	}
+
+	database := client.Database("taskprocessor_test_" + primitive.NewObjectID().Hex())
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		database.Drop(ctx)
+		client.Disconnect(ctx)
+	})
+	return NewTaskRepository(database.Collection("tasks"))
+}
+
+// offlineRepository repositorio sin servidor: sirve para los caminos que fallan
+// antes de llegar a MongoDB (validaciones)
+func offlineRepository(t *testing.T) *TaskRepository {
+	t.Helper()
+	client, err := mongo.Connect(context.Background(), options.Client().
+		ApplyURI("mongodb://127.0.0.1:1").
+		SetServerSelectionTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Disconnect(context.Background()) })
+	return NewTaskRepository(client.Database("offline").Collection("tasks"))
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"taskProcessor/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrInvalidPauseKind se retorna cuando el tipo de pausa no es "queue" ni "type"
+var ErrInvalidPauseKind = errors.New("tipo de pausa inválido (usar queue o type)")
+
+// PauseRepository guarda qué colas y tipos de tarea están pausados
+type PauseRepository struct {
+	collection *mongo.Collection
+}
+
+func NewPauseRepository(collection *mongo.Collection) *PauseRepository {
+	return &PauseRepository{
+		collection: collection,
+	}
+}
+
+// Pause pausa una cola o un tipo de tarea. Pausar algo ya pausado solo actualiza el motivo.
+func (r *PauseRepository) Pause(ctx context.Context, kind, name, reason string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if kind != models.PauseKindQueue && kind != models.PauseKindType {
+		return ErrInvalidPauseKind
+	}
+	if name == "" {
+		return fmt.Errorf("el nombre de la cola o tipo es obligatorio")
+	}
+
+	pause := models.Pause{
+		ID:       models.PauseID(kind, name),
+		Kind:     kind,
+		Name:     name,
+		Reason:   reason,
+		PausedAt: time.Now(),
+	}
+	opts := options.Replace().SetUpsert(true)
+	if _, err := r.collection.ReplaceOne(ctx, bson.M{"_id": pause.ID}, pause, opts); err != nil {
+		return fmt.Errorf("error al pausar %s: %v", pause.ID, err)
+	}
+	return nil
+}
+
+// Resume quita la pausa de una cola o tipo. Retorna false si no estaba pausado.
+func (r *PauseRepository) Resume(ctx context.Context, kind, name string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": models.PauseID(kind, name)})
+	if err != nil {
+		return false, fmt.Errorf("error al reanudar %s: %v", models.PauseID(kind, name), err)
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// List retorna todas las pausas activas
+func (r *PauseRepository) List(ctx context.Context) ([]*models.Pause, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "paused_at", Value: 1}})
+	cursor, err := r.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error al listar pausas: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	pauses := []*models.Pause{}
+	if err = cursor.All(ctx, &pauses); err != nil {
+		return nil, fmt.Errorf("error al decodificar pausas: %v", err)
+	}
+	return pauses, nil
+}
+
+// Paused retorna los nombres de colas y tipos pausados, listos para usar en un filtro $nin
+func (r *PauseRepository) Paused(ctx context.Context) (queues []string, types []string, err error) {
+	pauses, err := r.List(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, pause := range pauses {
+		switch pause.Kind {
+		case models.PauseKindQueue:
+			queues = append(queues, pause.Name)
+		case models.PauseKindType:
+			types = append(types, pause.Name)
+		}
+	}
+	return queues, types, nil
+}
@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"taskProcessor/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrQueueFull se retorna al encolar en una cola o tipo que llegó a su máximo de
+// tareas pendientes. El error concreto es un *QueueFullError.
+var ErrQueueFull = errors.New("la cola está llena")
+
+// QueueFullError detalle de qué límite rechazó la tarea
+type QueueFullError struct {
+	Kind       string // "queue" o "type"
+	Name       string
+	MaxPending int64
+}
+
+func (e *QueueFullError) Error() string {
+	return fmt.Sprintf("%v: %s %s tiene %d tareas pendientes (máximo)", ErrQueueFull, e.Kind, e.Name, e.MaxPending)
+}
+
+// Is permite usar errors.Is(err, ErrQueueFull)
+func (e *QueueFullError) Is(target error) bool {
+	return target == ErrQueueFull
+}
+
+// QueueLimitRepository máximos de tareas pendientes por cola y por tipo
+type QueueLimitRepository struct {
+	collection *mongo.Collection
+}
+
+func NewQueueLimitRepository(collection *mongo.Collection) *QueueLimitRepository {
+	return &QueueLimitRepository{
+		collection: collection,
+	}
+}
+
+// SetLimit configura el máximo de tareas pendientes de una cola o tipo
+func (r *QueueLimitRepository) SetLimit(ctx context.Context, kind, name string, maxPending int64) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if kind != models.PauseKindQueue && kind != models.PauseKindType {
+		return ErrInvalidPauseKind
+	}
+	if name == "" {
+		return fmt.Errorf("el nombre de la cola o tipo es obligatorio")
+	}
+	if maxPending <= 0 {
+		return fmt.Errorf("máximo de tareas pendientes inválido: %d", maxPending)
+	}
+
+	limit := models.QueueLimit{
+		ID:         models.PauseID(kind, name),
+		Kind:       kind,
+		Name:       name,
+		MaxPending: maxPending,
+		UpdatedAt:  time.Now(),
+	}
+	opts := options.Replace().SetUpsert(true)
+	if _, err := r.collection.ReplaceOne(ctx, bson.M{"_id": limit.ID}, limit, opts); err != nil {
+		return fmt.Errorf("error al configurar el límite de %s: %v", limit.ID, err)
+	}
+	return nil
+}
+
+// RemoveLimit quita el límite de una cola o tipo. Retorna false si no tenía.
+func (r *QueueLimitRepository) RemoveLimit(ctx context.Context, kind, name string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": models.PauseID(kind, name)})
+	if err != nil {
+		return false, fmt.Errorf("error al quitar el límite de %s: %v", models.PauseID(kind, name), err)
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// List retorna todos los límites configurados
+func (r *QueueLimitRepository) List(ctx context.Context) ([]*models.QueueLimit, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	cursor, err := r.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error al listar límites de cola: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	limits := []*models.QueueLimit{}
+	if err = cursor.All(ctx, &limits); err != nil {
+		return nil, fmt.Errorf("error al decodificar límites de cola: %v", err)
+	}
+	return limits, nil
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"taskProcessor/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RateLimitRepository token buckets por tipo de tarea. Cada bucket es un documento
+// que se actualiza atómicamente, así el límite se respeta entre todos los procesos.
+type RateLimitRepository struct {
+	collection *mongo.Collection
+}
+
+func NewRateLimitRepository(collection *mongo.Collection) *RateLimitRepository {
+	return &RateLimitRepository{
+		collection: collection,
+	}
+}
+
+// SetLimit configura el límite de un tipo (rate tareas por segundo, hasta burst seguidas).
+// Si el bucket ya existe conserva sus tokens actuales.
+func (r *RateLimitRepository) SetLimit(ctx context.Context, taskType string, rate float64, burst int) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if rate <= 0 {
+		return fmt.Errorf("rate inválido para %s: %v", taskType, rate)
+	}
+	if burst < 1 {
+		burst = 1
+	}
+
+	update := bson.M{
+		"$set":         bson.M{"rate": rate, "burst": float64(burst)},
+		"$setOnInsert": bson.M{"tokens": float64(burst), "updated_at": time.Now()},
+	}
+	opts := options.Update().SetUpsert(true)
+	if _, err := r.collection.UpdateOne(ctx, bson.M{"_id": taskType}, update, opts); err != nil {
+		return fmt.Errorf("error al configurar rate limit de %s: %v", taskType, err)
+	}
+	return nil
+}
+
+// RemoveLimit quita el límite de un tipo
+func (r *RateLimitRepository) RemoveLimit(ctx context.Context, taskType string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if _, err := r.collection.DeleteOne(ctx, bson.M{"_id": taskType}); err != nil {
+		return fmt.Errorf("error al quitar rate limit de %s: %v", taskType, err)
+	}
+	return nil
+}
+
+// List retorna los límites configurados, indexados por tipo
+func (r *RateLimitRepository) List(ctx context.Context) (map[string]*models.RateLimit, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	cursor, err := r.collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("error al listar rate limits: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var limits []*models.RateLimit
+	if err = cursor.All(ctx, &limits); err != nil {
+		return nil, fmt.Errorf("error al decodificar rate limits: %v", err)
+	}
+
+	byType := make(map[string]*models.RateLimit, len(limits))
+	for _, limit := range limits {
+		byType[limit.Type] = limit
+	}
+	return byType, nil
+}
+
+// TryTake intenta consumir un token del bucket del tipo. Recarga y consumo se
+// hacen en un solo FindOneAndUpdate con pipeline, así dos procesos no pueden
+// gastar el mismo token. Si se concedió se calcula con el documento anterior al
+// update, repitiendo la misma cuenta que el pipeline (mismo now, en milisegundos
+// como las fechas de MongoDB). Retorna true si no hay límite para el tipo.
+func (r *RateLimitRepository) TryTake(ctx context.Context, taskType string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	now := time.Now().Truncate(time.Millisecond)
+
+	// Segundos desde la última recarga (nunca negativo si los relojes difieren)
+	elapsed := bson.M{"$max": bson.A{0, bson.M{"$divide": bson.A{
+		bson.M{"$subtract": bson.A{now, "$updated_at"}}, 1000,
+	}}}}
+	refilled := bson.M{"$min": bson.A{"$burst", bson.M{"$add": bson.A{
+		"$tokens", bson.M{"$multiply": bson.A{elapsed, "$rate"}},
+	}}}}
+	hasToken := bson.M{"$gte": bson.A{"$tokens", 1}}
+
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"tokens": refilled, "updated_at": now}}},
+		{{Key: "$set", Value: bson.M{
+			"tokens": bson.M{"$cond": bson.A{hasToken, bson.M{"$subtract": bson.A{"$tokens", 1}}, "$tokens"}},
+		}}},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+
+	var before models.RateLimit
+	err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": taskType}, update, opts).Decode(&before)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return true, nil
+		}
+		return false, fmt.Errorf("error al consumir token de %s: %v", taskType, err)
+	}
+
+	elapsedMs := max(0, now.UnixMilli()-before.UpdatedAt.UnixMilli())
+	tokens := min(before.Burst, before.Tokens+float64(elapsedMs)/1000*before.Rate)
+	return tokens >= 1, nil
+}
+
+// Refund devuelve al bucket del tipo un token que se consumió para una tarea que
+// al final no se entregó (sin pasar de burst)
+func (r *RateLimitRepository) Refund(ctx context.Context, taskType string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"tokens": bson.M{"$min": bson.A{"$burst", bson.M{"$add": bson.A{"$tokens", 1}}}}}}},
+	}
+	if _, err := r.collection.UpdateOne(ctx, bson.M{"_id": taskType}, update); err != nil {
+		return fmt.Errorf("error al devolver token de %s: %v", taskType, err)
+	}
+	return nil
+}
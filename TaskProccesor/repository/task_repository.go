@@ -2,7 +2,12 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"regexp"
+	"sync/atomic"
+	"taskProcessor/events"
 	"taskProcessor/models"
 	"time"
 
@@ -12,33 +17,370 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ErrTaskNotOwned se retorna cuando un worker intenta modificar una tarea
+// que no tiene reclamada (o que ya fue procesada)
+var ErrTaskNotOwned = errors.New("la tarea no está reclamada por este worker")
+
+// ErrTaskNotFound se retorna cuando la tarea no existe
+var ErrTaskNotFound = errors.New("tarea no encontrada")
+
+// ErrInvalidState se retorna cuando la tarea no está en un estado que permita la operación
+var ErrInvalidState = errors.New("la tarea no está en un estado válido para esta operación")
+
+// ErrChangeStreamsUnsupported se retorna cuando el servidor no soporta change
+// streams (mongod standalone, sin replica set)
+var ErrChangeStreamsUnsupported = errors.New("el servidor de MongoDB no soporta change streams")
+
+// DefaultLeaseDuration tiempo que un worker tiene una tarea reclamada antes de que
+// se considere abandonada, salvo que extienda el lease con ExtendLease
+const DefaultLeaseDuration = 5 * time.Minute
+
+// ClaimOptions restricciones opcionales al reclamar tareas
+type ClaimOptions struct {
+	Queues        []string      // Solo estas colas (vacío = todas)
+	Types         []string      // Solo estos tipos (vacío = todos): los que el pool sabe procesar
+	Tags          []string      // Tags que ofrece el worker: solo tareas cuyas required_tags estén todas acá
+	LeaseDuration time.Duration // Duración del lease (0 = DefaultLeaseDuration)
+}
+
 type TaskRepository struct {
-	collection *mongo.Collection
+	collection  *mongo.Collection
+	pauses      *PauseRepository
+	breakers    *BreakerRepository
+	rateLimits  *RateLimitRepository
+	concurrency *ConcurrencyRepository
+	queueLimits *QueueLimitRepository
+
+	// noTransactions se activa la primera vez que el servidor rechaza una
+	// transacción (mongod standalone) para no volver a intentarlo
+	noTransactions atomic.Bool
+
+	// bus recibe las transiciones de las tareas (nil = no se publican)
+	bus *events.Bus
 }
 
 func NewTaskRepository(collection *mongo.Collection) *TaskRepository {
 	return &TaskRepository{
-		collection: collection,
+		collection:  collection,
+		pauses:      NewPauseRepository(collection.Database().Collection("queue_pauses")),
+		breakers:    NewBreakerRepository(collection.Database().Collection("circuit_breakers")),
+		rateLimits:  NewRateLimitRepository(collection.Database().Collection("rate_limits")),
+		concurrency: NewConcurrencyRepository(collection.Database().Collection("concurrency_slots")),
+		queueLimits: NewQueueLimitRepository(collection.Database().Collection("queue_limits")),
+	}
+}
+
+// EnsureIndexes crea los índices que necesitan las consultas del repositorio
+// (si ya existen no hace nada). Se llama al arrancar.
+func (r *TaskRepository) EnsureIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	indexes := []mongo.IndexModel{
+		// EventsSince: el polling de eventos solo lee tareas con eventos recientes
+		{Keys: bson.D{{Key: "events.at", Value: 1}}},
 	}
+	if _, err := r.collection.Indexes().CreateMany(ctx, indexes); err != nil {
+		return fmt.Errorf("error al crear índices de tareas: %v", err)
+	}
+	return nil
 }
 
+// SetEventBus publica en bus cada transición que hace este repositorio
+func (r *TaskRepository) SetEventBus(bus *events.Bus) {
+	r.bus = bus
+}
+
+// Create encola una tarea. Si su cola o su tipo llegó al máximo de tareas
+// pendientes retorna un *QueueFullError (errors.Is(err, ErrQueueFull)).
 func (r *TaskRepository) Create(ctx context.Context, task *models.Task) error {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
+	prepareNewTask(task)
+
+	rejected, err := r.admit(ctx, []*models.Task{task})
+	if err != nil {
+		return err
+	}
+	if rejected[0] != nil {
+		return rejected[0]
+	}
+
+	_, err = r.collection.InsertOne(ctx, task)
+	if err != nil {
+		return fmt.Errorf("error al crear trarea: %v", err)
+	}
+	r.publishLast(task)
+	return nil
+}
+
+// admit aplica los máximos de tareas pendientes por cola y por tipo a tareas
+// nuevas. Retorna un error por tarea: nil si se puede insertar o *QueueFullError.
+// Contar e insertar no es atómico: con varios productores a la vez el máximo se
+// puede superar por unas pocas tareas.
+func (r *TaskRepository) admit(ctx context.Context, tasks []*models.Task) ([]error, error) {
+	rejected := make([]error, len(tasks))
+	limits, err := r.queueLimits.List(ctx)
+	if err != nil || len(limits) == 0 {
+		return rejected, err
+	}
+	byID := make(map[string]*models.QueueLimit, len(limits))
+	for _, limit := range limits {
+		byID[limit.ID] = limit
+	}
+
+	pending := map[string]int64{} // Pendientes por límite, contando las ya admitidas
+	for i, task := range tasks {
+		if task.Status != models.StatusPending {
+			continue
+		}
+		var applicable []*models.QueueLimit
+		for _, id := range []string{models.PauseID(models.PauseKindQueue, task.Queue), models.PauseID(models.PauseKindType, task.Type)} {
+			if limit, ok := byID[id]; ok {
+				applicable = append(applicable, limit)
+			}
+		}
+
+		for _, limit := range applicable {
+			count, counted := pending[limit.ID]
+			if !counted {
+				if count, err = r.countPendingFor(ctx, limit); err != nil {
+					return nil, err
+				}
+				pending[limit.ID] = count
+			}
+			if count >= limit.MaxPending {
+				rejected[i] = &QueueFullError{Kind: limit.Kind, Name: limit.Name, MaxPending: limit.MaxPending}
+				break
+			}
+		}
+		if rejected[i] == nil {
+			for _, limit := range applicable {
+				pending[limit.ID]++
+			}
+		}
+	}
+	return rejected, nil
+}
+
+// countPendingFor cuenta las tareas pendientes de la cola o el tipo del límite
+func (r *TaskRepository) countPendingFor(ctx context.Context, limit *models.QueueLimit) (int64, error) {
+	field := "queue"
+	if limit.Kind == models.PauseKindType {
+		field = "type"
+	}
+	filter := pendingFilter()
+	filter[field] = limit.Name
+
+	count, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("error al contar tareas pendientes de %s: %v", limit.ID, err)
+	}
+	return count, nil
+}
+
+// prepareNewTask completa los valores por defecto de una tarea nueva
+func prepareNewTask(task *models.Task) {
 	if task.ID.IsZero() {
 		task.ID = primitive.NewObjectID()
 	}
-
 	if task.CreatedAt.IsZero() {
 		task.CreatedAt = time.Now()
 	}
+	if task.Queue == "" {
+		task.Queue = models.DefaultQueue
+	}
+	if task.Status == "" {
+		task.Status = models.StatusPending
+	}
+	if task.MaxAttempts <= 0 {
+		task.MaxAttempts = models.DefaultMaxAttempts
+	}
+	if task.ConcurrencyKey != "" && task.MaxConcurrency <= 0 {
+		task.MaxConcurrency = 1
+	}
+	if len(task.Events) == 0 {
+		task.Events = []models.TaskEvent{models.NewTaskEvent(models.EventCreated, "", "")}
+	}
+}
+
+// BackfillStatus completa status, queue y max_attempts en tareas creadas antes de
+// que existieran (solo tenían processed). Sin status ninguna consulta las vería:
+// ni el reclamo, ni los conteos, ni taskctl. Es idempotente; se llama al arrancar.
+func (r *TaskRepository) BackfillStatus(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
 
-	_, err := r.collection.InsertOne(ctx, task)
+	filter := bson.M{"status": bson.M{"$exists": false}}
+	update := bson.A{bson.M{"$set": bson.M{
+		"status": bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{"$processed", true}}, models.StatusProcessed, models.StatusPending,
+		}},
+		"queue":        bson.M{"$ifNull": bson.A{"$queue", models.DefaultQueue}},
+		"max_attempts": bson.M{"$ifNull": bson.A{"$max_attempts", models.DefaultMaxAttempts}},
+	}}}
+	result, err := r.collection.UpdateMany(ctx, filter, update)
 	if err != nil {
-		return fmt.Errorf("error al crear trarea: %v", err)
+		return 0, fmt.Errorf("error al completar el estado de tareas antiguas: %v", err)
 	}
-	return nil
+	return result.ModifiedCount, nil
+}
+
+// pendingFilter filtro de tareas listas para ser reclamadas
+func pendingFilter() bson.M {
+	return bson.M{"status": models.StatusPending}
+}
+
+// claimGuards breakers no cerrados y rate limits vigentes al armar el filtro de reclamo
+type claimGuards struct {
+	breakers   map[string]*models.CircuitBreaker
+	rateLimits map[string]*models.RateLimit
+}
+
+// claimFilter filtro de tareas que un worker puede reclamar ahora: pendientes,
+// sin run_at futuro ni expires_at vencido, de colas/tipos que no estén pausados, de tipos sin circuit
+// breaker abierto, con tokens de rate limit disponibles y de claves de
+// concurrencia sin llenar.
+// Con allowProbes no se excluyen los tipos cuyo breaker ya cumplió el cooldown
+// (la tarea que se reclame será la de prueba); sin él se excluyen además todos
+// los tipos con rate limit y las tareas con clave de concurrencia, porque el
+// lote no puede consumir un token ni ocupar un slot por tarea.
+func (r *TaskRepository) claimFilter(ctx context.Context, allowProbes bool) (bson.M, *claimGuards, error) {
+	filter := pendingFilter()
+	// Tareas en backoff: no se ofrecen hasta run_at. Las vencidas no se
+	// ofrecen aunque el sweeper todavía no las haya pasado a expired.
+	now := time.Now()
+	filter["run_at"] = bson.M{"$not": bson.M{"$gt": now}}
+	filter["expires_at"] = bson.M{"$not": bson.M{"$lte": now}}
+
+	pausedQueues, pausedTypes, err := r.pauses.Paused(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	breakers, err := r.breakers.NotClosed(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	rateLimits, err := r.rateLimits.List(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	saturatedKeys, err := r.concurrency.Saturated(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	excludedTypes := pausedTypes
+	for taskType, breaker := range breakers {
+		if !allowProbes || breaker.Blocks(now) {
+			excludedTypes = append(excludedTypes, taskType)
+		}
+	}
+	for taskType, limit := range rateLimits {
+		if !allowProbes || limit.Available(now) < 1 {
+			excludedTypes = append(excludedTypes, taskType)
+		}
+	}
+
+	if len(pausedQueues) > 0 {
+		filter["queue"] = bson.M{"$nin": pausedQueues}
+	}
+	if len(excludedTypes) > 0 {
+		filter["type"] = bson.M{"$nin": excludedTypes}
+	}
+	if !allowProbes {
+		filter["concurrency_key"] = bson.M{"$exists": false}
+	} else if len(saturatedKeys) > 0 {
+		filter["concurrency_key"] = bson.M{"$nin": saturatedKeys}
+	}
+	return filter, &claimGuards{breakers: breakers, rateLimits: rateLimits}, nil
+}
+
+// withTags limita el filtro a las tareas cuyas required_tags son un subconjunto de
+// tags: ninguna tag requerida queda fuera de las que ofrece el worker. Las tareas
+// sin required_tags las puede reclamar cualquiera.
+func withTags(filter bson.M, tags []string) {
+	if tags == nil {
+		tags = []string{} // $nin no acepta null
+	}
+	filter["required_tags"] = bson.M{"$not": bson.M{"$elemMatch": bson.M{"$nin": tags}}}
+}
+
+// inValues combina la exclusión que ya tenga el campo (colas pausadas, tipos
+// bloqueados) con los valores pedidos
+func inValues(current interface{}, values []string) bson.M {
+	condition := bson.M{"$in": values}
+	if excluded, ok := current.(bson.M); ok {
+		condition["$nin"] = excluded["$nin"]
+	}
+	return condition
+}
+
+// restrict limita el filtro de reclamo a las colas, los tipos y las tags del worker
+func (claimOpts ClaimOptions) restrict(filter bson.M) {
+	if len(claimOpts.Queues) > 0 {
+		filter["queue"] = inValues(filter["queue"], claimOpts.Queues)
+	}
+	if len(claimOpts.Types) > 0 {
+		filter["type"] = inValues(filter["type"], claimOpts.Types)
+	}
+	withTags(filter, claimOpts.Tags)
+}
+
+// CreateMany inserta varias tareas en una sola operación bulk.
+// Retorna un slice de errores alineado con tasks (nil si esa tarea se insertó bien,
+// *QueueFullError si su cola o tipo está lleno) y un error general si la operación
+// completa falló.
+func (r *TaskRepository) CreateMany(ctx context.Context, tasks []*models.Task) ([]error, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if len(tasks) == 0 {
+		return []error{}, nil
+	}
+
+	for _, task := range tasks {
+		prepareNewTask(task)
+	}
+	itemErrors, err := r.admit(ctx, tasks)
+	if err != nil {
+		return nil, err
+	}
+
+	// positions[j] es la posición en tasks de docs[j]
+	var docs []interface{}
+	var positions []int
+	for i, task := range tasks {
+		if itemErrors[i] == nil {
+			docs = append(docs, task)
+			positions = append(positions, i)
+		}
+	}
+	if len(docs) == 0 {
+		return itemErrors, nil
+	}
+
+	// Ordered(false): un error en una tarea no detiene la inserción del resto
+	opts := options.InsertMany().SetOrdered(false)
+	_, err = r.collection.InsertMany(ctx, docs, opts)
+	if err != nil {
+		var bulkErr mongo.BulkWriteException
+		if !errors.As(err, &bulkErr) || len(bulkErr.WriteErrors) == 0 {
+			return nil, fmt.Errorf("error al crear tareas: %v", err)
+		}
+		for _, writeErr := range bulkErr.WriteErrors {
+			if writeErr.Index >= 0 && writeErr.Index < len(positions) {
+				itemErrors[positions[writeErr.Index]] = fmt.Errorf("error al crear tarea: %s", writeErr.Message)
+			}
+		}
+	}
+	for i, task := range tasks {
+		if itemErrors[i] == nil {
+			r.publishLast(task)
+		}
+	}
+	return itemErrors, nil
 }
 
 func (r *TaskRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.Task, error) {
@@ -82,14 +424,42 @@ func (r *TaskRepository) FindAll(ctx context.Context, limit int64) ([]*models.Ta
 	return tasks, nil
 }
 
-func (r *TaskRepository) FindPending(ctx context.Context, limit int64) ([]*models.Task, error) {
+// FindByStatusAndType lista tareas filtrando por estado y tipo (vacío = cualquiera)
+func (r *TaskRepository) FindByStatusAndType(ctx context.Context, status, taskType string, limit int64) ([]*models.Task, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	filter := bson.M{
-		"processed":  false,
-		"claimed_by": bson.M{"$exists": false},
+	filter := bson.M{}
+	if status != "" {
+		filter["status"] = status
+	}
+	if taskType != "" {
+		filter["type"] = taskType
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error al listar tareas: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var tasks []*models.Task
+	if err = cursor.All(ctx, &tasks); err != nil {
+		return nil, fmt.Errorf("error al decodificar tareas: %v", err)
 	}
+	return tasks, nil
+}
+
+func (r *TaskRepository) FindPending(ctx context.Context, limit int64) ([]*models.Task, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	filter := pendingFilter()
 
 	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
 	if limit > 0 {
@@ -110,82 +480,1236 @@ func (r *TaskRepository) FindPending(ctx context.Context, limit int64) ([]*model
 }
 
 func (r *TaskRepository) ClaimTask(ctx context.Context, workerID string) (*models.Task, error) {
+	return r.ClaimTaskWithOptions(ctx, workerID, ClaimOptions{})
+}
+
+// ClaimTaskWithOptions igual que ClaimTask pero limitando las colas, las tags que
+// ofrece el worker y la duración del lease
+func (r *TaskRepository) ClaimTaskWithOptions(ctx context.Context, workerID string, claimOpts ClaimOptions) (*models.Task, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	now := time.Now()
+	leaseDuration := claimOpts.LeaseDuration
+	if leaseDuration <= 0 {
+		leaseDuration = DefaultLeaseDuration
+	}
+
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.After).
+		SetSort(bson.D{{Key: "created_at", Value: 1}})
+
+	// Se reintenta si la tarea reclamada resulta ser de una clave de concurrencia
+	// llena, de un tipo sin tokens de rate limit o cuyo probe de circuit breaker
+	// ya tomó otro worker
+	for attempt := 0; attempt < 3; attempt++ {
+		filter, guards, err := r.claimFilter(ctx, true)
+		if err != nil {
+			return nil, fmt.Errorf("error al reclamar tarea: %v", err)
+		}
+		claimOpts.restrict(filter)
+
+		now := time.Now()
+		update := bson.M{
+			"$set": bson.M{
+				"status":      models.StatusRunning,
+				"claimed_by":  workerID,
+				"claimed_at":  now, // Ahora es time.Time
+				"lease_until": now.Add(leaseDuration),
+			},
+			"$inc":  bson.M{"attempts": 1},
+			"$push": bson.M{"events": models.NewTaskEvent(models.EventClaimed, workerID, "")},
+		}
+
+		var task models.Task
+		err = r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&task)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("error al reclamar tarea: %v", err)
+		}
+
+		// Con clave de concurrencia la tarea solo se entrega si ocupa un slot;
+		// otro proceso pudo llenar la clave desde que se armó el filtro
+		if task.ConcurrencyKey != "" {
+			acquired, err := r.concurrency.Acquire(ctx, task.ConcurrencyKey, task.MaxConcurrency, task.ID)
+			if err != nil || !acquired {
+				if unclaimErr := r.unclaim(ctx, &task, false); unclaimErr != nil {
+					return nil, unclaimErr
+				}
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+
+		// Con rate limit la tarea solo se entrega si se consigue un token;
+		// otro proceso pudo gastar el último desde que se armó el filtro
+		_, limited := guards.rateLimits[task.Type]
+		if limited {
+			granted, err := r.rateLimits.TryTake(ctx, task.Type)
+			if err != nil || !granted {
+				if unclaimErr := r.unclaim(ctx, &task, false); unclaimErr != nil {
+					return nil, unclaimErr
+				}
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+
+		if _, hasBreaker := guards.breakers[task.Type]; !hasBreaker {
+			r.publishLast(&task)
+			return &task, nil
+		}
+
+		// El breaker del tipo cumplió su cooldown: esta tarea solo se procesa
+		// si somos el worker que consigue hacer la prueba (half-open)
+		acquired, err := r.breakers.AcquireProbe(ctx, task.Type, leaseDuration)
+		if err == nil && acquired {
+			r.publishLast(&task)
+			return &task, nil
+		}
+		// El token ya consumido vuelve al bucket: la tarea no se ejecuta
+		if unclaimErr := r.unclaim(ctx, &task, limited); unclaimErr != nil {
+			return nil, unclaimErr
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// unclaim devuelve a pending una tarea que el worker reclamó pero no va a procesar
+// y libera su slot de concurrencia. Con refundToken devuelve también el token de
+// rate limit que se consumió para ella. No cuenta como intento.
+func (r *TaskRepository) unclaim(ctx context.Context, task *models.Task, refundToken bool) error {
+	if task.ConcurrencyKey != "" {
+		if err := r.concurrency.Release(ctx, task.ID); err != nil {
+			return err
+		}
+	}
+	if refundToken {
+		if err := r.rateLimits.Refund(ctx, task.Type); err != nil {
+			return err
+		}
+	}
 
 	filter := bson.M{
-		"processed":  false,
-		"claimed_by": bson.M{"$exists": false},
+		"_id":        task.ID,
+		"claimed_by": task.ClaimedBy,
+		"status":     models.StatusRunning,
+	}
+	update := bson.M{
+		"$set":   bson.M{"status": models.StatusPending},
+		"$inc":   bson.M{"attempts": -1},
+		"$unset": bson.M{"claimed_by": "", "claimed_at": "", "claim_id": "", "lease_until": ""},
+		"$pop":   bson.M{"events": 1}, // Se descarta el evento claimed: no hubo intento
+	}
+
+	if _, err := r.collection.UpdateOne(ctx, filter, update); err != nil {
+		return fmt.Errorf("error al devolver tarea a la cola: %v", err)
+	}
+	return nil
+}
+
+// ClaimBatch reclama atómicamente hasta n tareas pendientes para un worker.
+// Cada tarea se marca con un claim_id único del lote, así ninguna tarea puede
+// quedar reclamada por dos workers aunque compitan por los mismos candidatos.
+// Como el lote no declara tags, solo se reclaman tareas sin required_tags.
+func (r *TaskRepository) ClaimBatch(ctx context.Context, workerID string, n int) ([]*models.Task, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if n <= 0 {
+		return nil, nil
+	}
+
+	// En lote no se hacen probes, ni se consumen tokens, ni se ocupan slots: se
+	// excluyen los tipos con breaker no cerrado o con rate limit y las tareas
+	// con clave de concurrencia
+	filter, _, err := r.claimFilter(ctx, false)
+	if err != nil {
+		return nil, fmt.Errorf("error al reclamar lote de tareas: %v", err)
+	}
+	withTags(filter, nil) // El lote no declara tags: solo tareas sin required_tags
+
+	// 1. Buscar candidatos (solo sus IDs)
+	findOpts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}}).
+		SetLimit(int64(n)).
+		SetProjection(bson.M{"_id": 1})
+
+	cursor, err := r.collection.Find(ctx, filter, findOpts)
+	if err != nil {
+		return nil, fmt.Errorf("error al buscar tareas para reclamar: %v", err)
+	}
+	var candidates []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err = cursor.All(ctx, &candidates); err != nil {
+		return nil, fmt.Errorf("error al decodificar candidatos: %v", err)
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]primitive.ObjectID, len(candidates))
+	for i, candidate := range candidates {
+		ids[i] = candidate.ID
 	}
 
+	// 2. Reclamar solo los que siguen reclamables con el mismo filtro (otro worker
+	// pudo tomarlos, o pasaron a estar pausados, con run_at o vencidos); se evalúa
+	// por documento de forma atómica, así que nadie más se queda con la misma tarea
+	claimID := primitive.NewObjectID()
+	updateFilter := bson.M{"$and": bson.A{filter, bson.M{"_id": bson.M{"$in": ids}}}}
 	update := bson.M{
 		"$set": bson.M{
-			"claimed_by": workerID,
-			"claimed_at": now, // Ahora es time.Time
+			"status":      models.StatusRunning,
+			"claimed_by":  workerID,
+			"claimed_at":  time.Now(),
+			"claim_id":    claimID,
+			"lease_until": time.Now().Add(DefaultLeaseDuration),
 		},
-		"$inc": bson.M{"attempts": 1},
+		"$inc":  bson.M{"attempts": 1},
+		"$push": bson.M{"events": models.NewTaskEvent(models.EventClaimed, workerID, "")},
 	}
 
-	opts := options.FindOneAndUpdate().
-		SetReturnDocument(options.After).
-		SetSort(bson.D{{Key: "created_at", Value: 1}})
+	result, err := r.collection.UpdateMany(ctx, updateFilter, update)
+	if err != nil {
+		return nil, fmt.Errorf("error al reclamar lote de tareas: %v", err)
+	}
+	if result.ModifiedCount == 0 {
+		return nil, nil
+	}
 
-	var task models.Task
-	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&task)
+	// 3. Leer las tareas que quedaron marcadas con nuestro claim_id
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err = r.collection.Find(ctx, bson.M{"claim_id": claimID}, opts)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return nil, nil
-		}
-		return nil, fmt.Errorf("error al reclamar tarea: %v", err)
+		return nil, fmt.Errorf("error al leer lote reclamado: %v", err)
 	}
-	return &task, nil
+	defer cursor.Close(ctx)
+
+	var tasks []*models.Task
+	if err = cursor.All(ctx, &tasks); err != nil {
+		return nil, fmt.Errorf("error al decodificar lote reclamado: %v", err)
+	}
+	for _, task := range tasks {
+		r.publishLast(task)
+	}
+	return tasks, nil
 }
 
-func (r *TaskRepository) MarkAsProcessed(ctx context.Context, id primitive.ObjectID, result string) error {
+// UpdateProgress guarda el progreso de una tarea en curso.
+// Solo el worker que la reclamó puede actualizarlo; si no, retorna ErrTaskNotOwned.
+func (r *TaskRepository) UpdateProgress(ctx context.Context, id primitive.ObjectID, workerID string, progress models.TaskProgress) error {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	now := time.Now()
-	filter := bson.M{"_id": id}
+	if progress.Percent < 0 || progress.Percent > 100 {
+		return fmt.Errorf("porcentaje de progreso inválido: %d", progress.Percent)
+	}
+	progress.UpdatedAt = time.Now()
+
+	filter := bson.M{
+		"_id":        id,
+		"claimed_by": workerID,
+		"status":     models.StatusRunning,
+	}
 	update := bson.M{
-		"$set": bson.M{
-			"processed":    true,
-			"processed_at": now, // Ahora es time.Time
-			"result":       result,
-		},
+		"$set": bson.M{"progress": progress},
 	}
 
-	_, err := r.collection.UpdateOne(ctx, filter, update)
+	// El progreso no va al historial, pero sí al bus
+	task, err := r.updateForEvent(ctx, filter, update)
 	if err != nil {
-		return fmt.Errorf("error al marcar tarea como procesada: %v", err)
+		return fmt.Errorf("error al actualizar progreso: %v", err)
+	}
+	if task == nil {
+		return ErrTaskNotOwned
+	}
+	message := fmt.Sprintf("%d%%", progress.Percent)
+	if progress.Message != "" {
+		message += " " + progress.Message
 	}
+	r.publish(task, models.TaskEvent{
+		Type:     events.TypeProgress,
+		At:       progress.UpdatedAt,
+		WorkerID: workerID,
+		Attempt:  task.Attempts,
+		Status:   task.Status,
+		Message:  message,
+	})
 	return nil
 }
 
-func (r *TaskRepository) CountAll(ctx context.Context) (int64, error) {
+// SaveCheckpoint guarda el checkpoint de una tarea en curso (reemplaza al anterior).
+// Solo el worker que la reclamó puede guardarlo; si no, retorna ErrTaskNotOwned.
+func (r *TaskRepository) SaveCheckpoint(ctx context.Context, id primitive.ObjectID, workerID string, data json.RawMessage) error {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	count, err := r.collection.CountDocuments(ctx, bson.M{})
+	filter := bson.M{
+		"_id":        id,
+		"claimed_by": workerID,
+		"status":     models.StatusRunning,
+	}
+	// El intento se toma del documento: es el del claim vigente
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"checkpoint": bson.M{
+			"data":     data,
+			"attempt":  "$attempts",
+			"saved_at": time.Now(),
+		}}}},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
 	if err != nil {
-		return 0, fmt.Errorf("error al contar tareas: %v", err)
+		return fmt.Errorf("error al guardar checkpoint: %v", err)
 	}
-	return count, nil
+	if result.MatchedCount == 0 {
+		return ErrTaskNotOwned
+	}
+	return nil
 }
 
-func (r *TaskRepository) CountPending(ctx context.Context) (int64, error) {
+// MarkAsProcessed marca como procesada una tarea reclamada por workerID.
+// Retorna ErrTaskNotOwned si el worker ya no la tiene (lease vencido, reaper,
+// cancelada o reclamada por otro); en ese caso no toca la tarea ni su slot de
+// concurrencia, que puede ser del nuevo dueño.
+func (r *TaskRepository) MarkAsProcessed(ctx context.Context, id primitive.ObjectID, workerID, result string) error {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
+
 	filter := bson.M{
-		"processed":  false,
-		"claimed_by": bson.M{"$exists": false},
+		"_id":        id,
+		"claimed_by": workerID,
+		"status":     models.StatusRunning,
+	}
+	update := bson.M{
+		"$set":   processedFields(result),
+		"$unset": processedUnset(),
+		"$push":  succeededEvent(workerID),
 	}
 
-	count, err := r.collection.CountDocuments(ctx, filter)
+	task, err := r.updateForEvent(ctx, filter, update)
 	if err != nil {
-		return 0, fmt.Errorf("error al contar tareas pendientes: %v", err)
+		return fmt.Errorf("error al marcar tarea como procesada: %v", err)
 	}
-	return count, nil
+	if task == nil {
+		return ErrTaskNotOwned
+	}
+	r.publishLast(task)
+	return r.concurrency.Release(ctx, id)
+}
+
+// succeededEvent $push del evento de éxito
+func succeededEvent(workerID string) bson.M {
+	return bson.M{"events": models.NewTaskEvent(models.EventSucceeded, workerID, "")}
+}
+
+// processedUnset campos que se descartan al terminar una tarea con éxito: el
+// checkpoint solo sirve para retomar un intento fallido
+func processedUnset() bson.M {
+	return bson.M{"checkpoint": ""}
+}
+
+// processedFields campos que se actualizan al terminar una tarea con éxito
+func processedFields(result string) bson.M {
+	return bson.M{
+		"status":       models.StatusProcessed,
+		"processed":    true,
+		"processed_at": time.Now(), // Ahora es time.Time
+		"result":       result,
+	}
+}
+
+// CompleteWithChildren marca como procesada una tarea reclamada por workerID y
+// encola sus tareas hijas de forma atómica: o quedan las dos cosas o ninguna.
+// Con replica set se usa una transacción. En un mongod standalone las hijas se
+// guardan primero dentro del documento del padre (en el mismo update que lo marca
+// procesado) y después se insertan con sus IDs ya asignados; si el proceso muere
+// en el medio, FlushPendingChildren termina la inserción sin duplicarlas.
+// Las hijas no pasan por admit a propósito: el padre ya terminó su trabajo y
+// rechazarlas por una cola llena perdería la continuación (ver flushChildren).
+func (r *TaskRepository) CompleteWithChildren(ctx context.Context, id primitive.ObjectID, workerID, result string, children []*models.Task) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	for _, child := range children {
+		prepareNewTask(child)
+		parentID := id
+		child.ParentID = &parentID
+	}
+
+	filter := bson.M{
+		"_id":        id,
+		"claimed_by": workerID,
+		"status":     models.StatusRunning,
+	}
+
+	if !r.noTransactions.Load() {
+		err := r.completeInTransaction(ctx, filter, workerID, result, children)
+		if !transactionsUnsupported(err) {
+			if err != nil {
+				return err
+			}
+			return r.concurrency.Release(ctx, id)
+		}
+		r.noTransactions.Store(true)
+	}
+
+	set := processedFields(result)
+	set["pending_children"] = children
+	parent, err := r.updateForEvent(ctx, filter, bson.M{"$set": set, "$unset": processedUnset(), "$push": succeededEvent(workerID)})
+	if err != nil {
+		return fmt.Errorf("error al marcar tarea como procesada: %v", err)
+	}
+	if parent == nil {
+		return ErrTaskNotOwned
+	}
+	r.publishLast(parent)
+	if err := r.concurrency.Release(ctx, id); err != nil {
+		return err
+	}
+	return r.flushChildren(ctx, id, children)
+}
+
+// completeInTransaction marca el padre y encola las hijas en una transacción
+func (r *TaskRepository) completeInTransaction(ctx context.Context, filter bson.M, workerID, result string, children []*models.Task) error {
+	session, err := r.collection.Database().Client().StartSession()
+	if err != nil {
+		return fmt.Errorf("error al iniciar sesión de MongoDB: %v", err)
+	}
+	defer session.EndSession(ctx)
+
+	var parent *models.Task
+	_, err = session.WithTransaction(ctx, func(sessionCtx mongo.SessionContext) (interface{}, error) {
+		update := bson.M{"$set": processedFields(result), "$unset": processedUnset(), "$push": succeededEvent(workerID)}
+		var err error
+		parent, err = r.updateForEvent(sessionCtx, filter, update)
+		if err != nil {
+			return nil, err
+		}
+		if parent == nil {
+			return nil, ErrTaskNotOwned
+		}
+		if len(children) == 0 {
+			return nil, nil
+		}
+
+		// Sin admit: los máximos de pendientes no aplican a las hijas
+		docs := make([]interface{}, len(children))
+		for i, child := range children {
+			docs[i] = child
+		}
+		_, err = r.collection.InsertMany(sessionCtx, docs)
+		return nil, err
+	})
+	if err != nil && !errors.Is(err, ErrTaskNotOwned) && !transactionsUnsupported(err) {
+		return fmt.Errorf("error al completar tarea con hijas: %v", err)
+	}
+	if err == nil {
+		r.publishLast(parent)
+		for _, child := range children {
+			r.publishLast(child)
+		}
+	}
+	return err
+}
+
+// transactionsUnsupported indica si el error es el de un mongod sin replica set
+func transactionsUnsupported(err error) bool {
+	var commandErr mongo.CommandError
+	return errors.As(err, &commandErr) && commandErr.Code == 20 // IllegalOperation
+}
+
+// flushChildren inserta las hijas guardadas en el padre y las quita de él.
+// Las que ya existían (inserción previa interrumpida) se ignoran. No pasan por
+// admit: el padre ya quedó procesado con ellas en pending_children, así que una
+// cola llena no puede rechazarlas sin perderlas; exceden el máximo como mucho en
+// las hijas de las tareas que terminan mientras la cola está llena.
+func (r *TaskRepository) flushChildren(ctx context.Context, parentID primitive.ObjectID, children []*models.Task) error {
+	if len(children) > 0 {
+		docs := make([]interface{}, len(children))
+		for i, child := range children {
+			docs[i] = child
+		}
+		_, err := r.collection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+		if err != nil && !onlyDuplicateKeys(err) {
+			return fmt.Errorf("error al encolar tareas hijas: %v", err)
+		}
+		// Las repetidas también se publican: el bus descarta lo que ya vio
+		for _, child := range children {
+			r.publishLast(child)
+		}
+	}
+
+	update := bson.M{"$unset": bson.M{"pending_children": ""}}
+	if _, err := r.collection.UpdateOne(ctx, bson.M{"_id": parentID}, update); err != nil {
+		return fmt.Errorf("error al confirmar tareas hijas: %v", err)
+	}
+	return nil
+}
+
+// onlyDuplicateKeys indica si todos los errores de un bulk insert son de _id repetido
+func onlyDuplicateKeys(err error) bool {
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || len(bulkErr.WriteErrors) == 0 || bulkErr.WriteConcernError != nil {
+		return false
+	}
+	for _, writeErr := range bulkErr.WriteErrors {
+		if writeErr.Code != 11000 {
+			return false
+		}
+	}
+	return true
+}
+
+// FlushPendingChildren termina de encolar las hijas de tareas cuyo padre se marcó
+// procesado sin transacción y el proceso murió antes de insertarlas
+func (r *TaskRepository) FlushPendingChildren(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"pending_children": bson.M{"$exists": true}}
+	opts := options.Find().SetProjection(bson.M{"pending_children": 1})
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return 0, fmt.Errorf("error al buscar tareas hijas pendientes: %v", err)
+	}
+	var parents []*models.Task
+	if err = cursor.All(ctx, &parents); err != nil {
+		return 0, fmt.Errorf("error al decodificar tareas hijas pendientes: %v", err)
+	}
+
+	var flushed int64
+	for _, parent := range parents {
+		if err := r.flushChildren(ctx, parent.ID, parent.PendingChildren); err != nil {
+			return flushed, err
+		}
+		flushed += int64(len(parent.PendingChildren))
+	}
+	return flushed, nil
+}
+
+// EnqueueCallbacks encola la entrega del webhook de hasta limit tareas con
+// callback_url que llegaron a un estado terminal. La tarea de entrega se guarda
+// como hija pendiente en el mismo update que registra callback_status, así cada
+// estado terminal produce una sola entrega aunque el proceso muera en el medio
+// (FlushPendingChildren termina la inserción).
+func (r *TaskRepository) EnqueueCallbacks(ctx context.Context, limit int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"callback_url":     bson.M{"$exists": true},
+		"status":           bson.M{"$in": models.TerminalStatuses},
+		"pending_children": bson.M{"$exists": false},
+		"$expr":            bson.M{"$ne": bson.A{"$callback_status", "$status"}},
+	}
+	opts := options.Find().
+		SetLimit(limit).
+		SetProjection(bson.M{"title": 1, "queue": 1, "status": 1, "callback_url": 1})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return 0, fmt.Errorf("error al buscar webhooks pendientes: %v", err)
+	}
+	var tasks []*models.Task
+	if err = cursor.All(ctx, &tasks); err != nil {
+		return 0, fmt.Errorf("error al decodificar webhooks pendientes: %v", err)
+	}
+
+	var enqueued int64
+	for _, task := range tasks {
+		delivery := models.NewTask(models.TypeWebhook, "Webhook: "+task.Title, map[string]interface{}{
+			"task_id": task.ID.Hex(),
+			"status":  task.Status,
+			"url":     task.CallbackURL,
+		})
+		delivery.Queue = task.Queue
+		delivery.MaxAttempts = models.WebhookMaxAttempts
+		parentID := task.ID
+		delivery.ParentID = &parentID
+		prepareNewTask(delivery)
+		children := []*models.Task{delivery}
+
+		// Condicional: si la tarea cambió de estado u otro proceso ya encoló
+		// este webhook, no se hace nada
+		updateFilter := bson.M{
+			"_id":              task.ID,
+			"status":           task.Status,
+			"callback_status":  bson.M{"$ne": task.Status},
+			"pending_children": bson.M{"$exists": false},
+		}
+		update := bson.M{"$set": bson.M{"callback_status": task.Status, "pending_children": children}}
+		result, err := r.collection.UpdateOne(ctx, updateFilter, update)
+		if err != nil {
+			return enqueued, fmt.Errorf("error al encolar webhook: %v", err)
+		}
+		if result.MatchedCount == 0 {
+			continue
+		}
+		if err := r.flushChildren(ctx, task.ID, children); err != nil {
+			return enqueued, err
+		}
+		enqueued++
+	}
+	return enqueued, nil
+}
+
+// MarkAsFailed registra un intento fallido de una tarea reclamada por workerID.
+// Si el error es reintentable y quedan intentos, la tarea vuelve a pending;
+// si no, pasa a dead (dead letter).
+func (r *TaskRepository) MarkAsFailed(ctx context.Context, id primitive.ObjectID, workerID string, errMsg string, retryable bool) error {
+	return r.MarkAsFailedWithStack(ctx, id, workerID, errMsg, "", retryable)
+}
+
+// MarkAsFailedWithStack igual que MarkAsFailed, guardando además el stack trace
+// del fallo (por ejemplo, cuando el handler entró en panic)
+func (r *TaskRepository) MarkAsFailedWithStack(ctx context.Context, id primitive.ObjectID, workerID string, errMsg, stack string, retryable bool) error {
+	return r.RecordFailure(ctx, id, workerID, Failure{Message: errMsg, Stack: stack, Retryable: retryable})
+}
+
+// Failure detalle de un intento fallido
+type Failure struct {
+	Message    string
+	Stack      string        // Stack trace si el handler entró en panic
+	Retryable  bool          // Si quedan intentos la tarea vuelve a pending
+	RetryDelay time.Duration // Espera antes de volver a ofrecer la tarea (0 = inmediata)
+}
+
+// RecordFailure registra un intento fallido de una tarea reclamada por workerID
+func (r *TaskRepository) RecordFailure(ctx context.Context, id primitive.ObjectID, workerID string, failure Failure) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"_id":        id,
+		"claimed_by": workerID,
+		"status":     models.StatusRunning,
+	}
+
+	task, err := r.updateForEvent(ctx, filter, failurePipeline(failure))
+	if err != nil {
+		return fmt.Errorf("error al marcar tarea como fallida: %v", err)
+	}
+	if task == nil {
+		return ErrTaskNotOwned
+	}
+	r.publishLast(task)
+	return r.concurrency.Release(ctx, id)
+}
+
+// failurePipeline pipeline de actualización para un intento fallido: el nuevo
+// estado se calcula en el servidor comparando attempts con max_attempts,
+// sin leer la tarea antes
+func failurePipeline(failure Failure) mongo.Pipeline {
+	nextStatus := interface{}(models.StatusDead)
+	if failure.Retryable {
+		nextStatus = bson.M{"$cond": bson.A{
+			bson.M{"$lt": bson.A{"$attempts", "$max_attempts"}},
+			models.StatusPending,
+			models.StatusDead,
+		}}
+	}
+
+	// Los textos van con $literal: en un pipeline un string que empieza con $
+	// se interpretaría como referencia a un campo
+	event := bson.M{
+		"type":      models.EventFailed,
+		"at":        time.Now(),
+		"worker_id": "$claimed_by",
+		"attempt":   "$attempts",
+		"status":    nextStatus,
+		"message":   bson.M{"$literal": failure.Message},
+	}
+	set := bson.M{
+		"status":     nextStatus,
+		"last_error": bson.M{"$literal": failure.Message},
+		"failed_at":  time.Now(),
+		"events":     bson.M{"$concatArrays": bson.A{bson.M{"$ifNull": bson.A{"$events", bson.A{}}}, bson.A{event}}},
+	}
+	unset := bson.A{"claimed_by", "claimed_at", "claim_id", "lease_until"}
+	if failure.Stack != "" {
+		set["last_error_stack"] = bson.M{"$literal": failure.Stack}
+	} else {
+		unset = append(unset, "last_error_stack")
+	}
+	if failure.Retryable && failure.RetryDelay > 0 {
+		set["run_at"] = time.Now().Add(failure.RetryDelay)
+	}
+
+	return mongo.Pipeline{
+		{{Key: "$set", Value: set}},
+		{{Key: "$unset", Value: unset}},
+	}
+}
+
+// ExtendLease extiende el lease de una tarea que el worker sigue procesando.
+// El heartbeat lo llama cada pocos segundos: solo la primera extensión de cada
+// intento queda en el historial, las siguientes solo mueven lease_until.
+func (r *TaskRepository) ExtendLease(ctx context.Context, id primitive.ObjectID, workerID string, duration time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"_id":        id,
+		"claimed_by": workerID,
+		"status":     models.StatusRunning,
+	}
+	event := models.NewTaskEvent(models.EventLeaseExtended, workerID, "")
+	history := bson.M{"$ifNull": bson.A{"$events", bson.A{}}}
+	update := bson.A{
+		bson.M{"$set": bson.M{
+			"lease_until": time.Now().Add(duration),
+			// Si el último evento ya es una extensión, el historial no cambia
+			"events": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{bson.M{"$arrayElemAt": bson.A{"$events.type", -1}}, models.EventLeaseExtended}},
+				history,
+				bson.M{"$concatArrays": bson.A{history, bson.A{bson.M{"$literal": event}}}},
+			}},
+		}},
+	}
+
+	task, err := r.updateForEvent(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("error al extender lease: %v", err)
+	}
+	if task == nil {
+		return ErrTaskNotOwned
+	}
+	// Solo se publica si el evento se agregó en este update
+	if len(task.Events) == 0 {
+		return nil
+	}
+	if last := task.Events[len(task.Events)-1]; last.Type == event.Type && last.At.UnixMilli() == event.At.UnixMilli() {
+		r.publishLast(task)
+	}
+	return nil
+}
+
+// ReleaseExpiredLeases libera las tareas cuyo lease venció (el worker murió o se colgó).
+// Cuentan como un intento fallido: vuelven a pending o pasan a dead.
+func (r *TaskRepository) ReleaseExpiredLeases(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"status":      models.StatusRunning,
+		"lease_until": bson.M{"$lt": time.Now()},
+	}
+
+	result, err := r.collection.UpdateMany(ctx, filter, failurePipeline(Failure{Message: "lease expirado", Retryable: true}))
+	if err != nil {
+		return 0, fmt.Errorf("error al liberar leases expirados: %v", err)
+	}
+	return result.ModifiedCount, nil
+}
+
+// ReleaseWorkerClaims libera las tareas en curso de un pool de workers muerto,
+// sin esperar a que venzan sus leases. Los worker IDs del pool empiezan con poolID + "/".
+func (r *TaskRepository) ReleaseWorkerClaims(ctx context.Context, poolID string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"status":     models.StatusRunning,
+		"claimed_by": bson.M{"$regex": "^" + regexp.QuoteMeta(poolID+"/")},
+	}
+
+	result, err := r.collection.UpdateMany(ctx, filter, failurePipeline(Failure{Message: "worker " + poolID + " sin heartbeat", Retryable: true}))
+	if err != nil {
+		return 0, fmt.Errorf("error al liberar tareas del worker %s: %v", poolID, err)
+	}
+	return result.ModifiedCount, nil
+}
+
+// ReleaseOrphanSlots libera los slots de concurrencia de tareas que ya no están
+// en ejecución (leases vencidos, pools muertos o un release que falló)
+func (r *TaskRepository) ReleaseOrphanSlots(ctx context.Context) (int64, error) {
+	slots, err := r.concurrency.InUse(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var holders []primitive.ObjectID
+	for _, slot := range slots {
+		holders = append(holders, slot.Holders...)
+	}
+	if len(holders) == 0 {
+		return 0, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": bson.M{"$in": holders}, "status": models.StatusRunning}
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, fmt.Errorf("error al buscar tareas con slot de concurrencia: %v", err)
+	}
+	var running []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err = cursor.All(ctx, &running); err != nil {
+		return 0, fmt.Errorf("error al decodificar tareas con slot de concurrencia: %v", err)
+	}
+
+	stillRunning := make(map[primitive.ObjectID]bool, len(running))
+	for _, task := range running {
+		stillRunning[task.ID] = true
+	}
+	var orphans []primitive.ObjectID
+	for _, id := range holders {
+		if !stillRunning[id] {
+			orphans = append(orphans, id)
+		}
+	}
+	return r.concurrency.Remove(ctx, orphans)
+}
+
+// Retry vuelve a encolar una tarea dead o cancelada, reiniciando sus intentos
+func (r *TaskRepository) Retry(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"_id":    id,
+		"status": bson.M{"$in": bson.A{models.StatusDead, models.StatusCancelled}},
+	}
+	update := bson.M{
+		"$set":   bson.M{"status": models.StatusPending, "attempts": 0},
+		"$unset": bson.M{"claimed_by": "", "claimed_at": "", "claim_id": "", "lease_until": "", "run_at": "", "callback_status": ""},
+		"$push":  bson.M{"events": models.NewTaskEvent(models.EventRetried, "", "")},
+	}
+
+	task, err := r.updateForEvent(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("error al reintentar tarea: %v", err)
+	}
+	if task == nil {
+		return r.notMatchedError(ctx, id)
+	}
+	r.publishLast(task)
+	return nil
+}
+
+// Events retorna el historial de eventos de una tarea, del más viejo al más nuevo
+func (r *TaskRepository) Events(ctx context.Context, id primitive.ObjectID) ([]models.TaskEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	opts := options.FindOne().SetProjection(bson.M{"events": 1})
+	var task models.Task
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}, opts).Decode(&task)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrTaskNotFound
+		}
+		return nil, fmt.Errorf("error al obtener eventos de la tarea: %v", err)
+	}
+	if task.Events == nil {
+		return []models.TaskEvent{}, nil
+	}
+	return task.Events, nil
+}
+
+// updateForEvent aplica update a la tarea que cumple filter y la retorna con lo
+// necesario para publicar la transición: tipo, cola, estado, intentos y el último
+// evento del historial (el que agregó el update). Retorna nil si no hubo tarea.
+func (r *TaskRepository) updateForEvent(ctx context.Context, filter bson.M, update interface{}) (*models.Task, error) {
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.After).
+		SetProjection(bson.M{"type": 1, "queue": 1, "status": 1, "attempts": 1, "events": bson.M{"$slice": -1}})
+
+	var task models.Task
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&task)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &task, nil
+}
+
+// publishLast publica el último evento del historial de la tarea
+func (r *TaskRepository) publishLast(task *models.Task) {
+	if task == nil || len(task.Events) == 0 {
+		return
+	}
+	event := task.Events[len(task.Events)-1]
+	if event.Status == "" {
+		event.Status = task.Status
+	}
+	if event.Attempt == 0 {
+		event.Attempt = task.Attempts
+	}
+	r.publish(task, event)
+}
+
+// publish envía la transición al bus, si hay uno
+func (r *TaskRepository) publish(task *models.Task, event models.TaskEvent) {
+	if r.bus == nil {
+		return
+	}
+	r.bus.Publish(events.Event{
+		TaskID:    task.ID.Hex(),
+		TaskType:  task.Type,
+		Queue:     task.Queue,
+		TaskEvent: event,
+	})
+}
+
+// WatchPending llama a notify cada vez que una tarea queda pending (nueva o
+// re-encolada) desde cualquier proceso, usando un change stream. Bloquea hasta
+// que se cancele el contexto o se corte el stream.
+func (r *TaskRepository) WatchPending(ctx context.Context, notify func()) error {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"$or": bson.A{
+			bson.M{"operationType": "insert", "fullDocument.status": models.StatusPending},
+			bson.M{"operationType": "update", "updateDescription.updatedFields.status": models.StatusPending},
+			bson.M{"operationType": "replace", "fullDocument.status": models.StatusPending},
+		}}}},
+		// Solo interesa que ocurrió: el _id (resume token) alcanza
+		{{Key: "$project", Value: bson.M{"_id": 1}}},
+	}
+
+	stream, err := r.collection.Watch(ctx, pipeline)
+	if err != nil {
+		if changeStreamsUnsupported(err) {
+			return ErrChangeStreamsUnsupported
+		}
+		return fmt.Errorf("error al abrir change stream: %v", err)
+	}
+	defer stream.Close(context.Background())
+
+	for stream.Next(ctx) {
+		notify()
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return fmt.Errorf("change stream interrumpido: %v", stream.Err())
+}
+
+// changeStreamsUnsupported indica si el error es el de un mongod sin replica set
+func changeStreamsUnsupported(err error) bool {
+	var commandErr mongo.CommandError
+	return errors.As(err, &commandErr) && commandErr.Code == 40573 // ChangeStreams solo en replica sets
+}
+
+// EventsSince retorna los eventos del historial posteriores a since, de cualquier
+// proceso, ordenados por fecha. Es la fuente del polling de GET /tasks/stream.
+func (r *TaskRepository) EventsSince(ctx context.Context, since time.Time, limit int64) ([]events.Event, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	// El primer $match usa el índice de events.at (ver EnsureIndexes): solo se
+	// desarma el historial de las tareas con algún evento posterior a since
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"events.at": bson.M{"$gt": since}}}},
+		{{Key: "$project", Value: bson.M{"type": 1, "queue": 1, "events": 1}}},
+		{{Key: "$unwind", Value: "$events"}},
+		{{Key: "$match", Value: bson.M{"events.at": bson.M{"$gt": since}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "events.at", Value: 1}}}},
+		{{Key: "$limit", Value: limit}},
+	}
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("error al buscar eventos recientes: %v", err)
+	}
+	var rows []struct {
+		ID    primitive.ObjectID `bson:"_id"`
+		Type  string             `bson:"type"`
+		Queue string             `bson:"queue"`
+		Event models.TaskEvent   `bson:"events"`
+	}
+	if err = cursor.All(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("error al decodificar eventos recientes: %v", err)
+	}
+
+	result := make([]events.Event, len(rows))
+	for i, row := range rows {
+		if row.Event.Status == "" {
+			row.Event.Status = events.StatusAfter(row.Event.Type)
+		}
+		result[i] = events.Event{
+			TaskID:    row.ID.Hex(),
+			TaskType:  row.Type,
+			Queue:     row.Queue,
+			TaskEvent: row.Event,
+		}
+	}
+	return result, nil
+}
+
+// Cancel cancela una tarea que todavía no fue reclamada
+func (r *TaskRepository) Cancel(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": id, "status": models.StatusPending}
+	update := bson.M{
+		"$set":  bson.M{"status": models.StatusCancelled},
+		"$push": bson.M{"events": models.NewTaskEvent(models.EventCancelled, "", "")},
+	}
+
+	task, err := r.updateForEvent(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("error al cancelar tarea: %v", err)
+	}
+	if task == nil {
+		return r.notMatchedError(ctx, id)
+	}
+	r.publishLast(task)
+	return nil
+}
+
+// ExpirePending pasa a expired las tareas pendientes cuyo expires_at ya venció
+func (r *TaskRepository) ExpirePending(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"status":     models.StatusPending,
+		"expires_at": bson.M{"$lte": time.Now()},
+	}
+	update := bson.M{
+		"$set":  bson.M{"status": models.StatusExpired},
+		"$push": bson.M{"events": models.NewTaskEvent(models.EventExpired, "", "")},
+	}
+
+	result, err := r.collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, fmt.Errorf("error al expirar tareas: %v", err)
+	}
+	return result.ModifiedCount, nil
+}
+
+// RequeueDead vuelve a encolar todas las tareas dead (opcionalmente solo de un tipo)
+func (r *TaskRepository) RequeueDead(ctx context.Context, taskType string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"status": models.StatusDead}
+	if taskType != "" {
+		filter["type"] = taskType
+	}
+	update := bson.M{
+		"$set":   bson.M{"status": models.StatusPending, "attempts": 0},
+		"$unset": bson.M{"claimed_by": "", "claimed_at": "", "claim_id": "", "lease_until": "", "run_at": "", "callback_status": ""},
+		"$push":  bson.M{"events": models.NewTaskEvent(models.EventRetried, "", "requeue-dead")},
+	}
+
+	result, err := r.collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, fmt.Errorf("error al re-encolar tareas dead: %v", err)
+	}
+	return result.ModifiedCount, nil
+}
+
+// PurgeOlderThan elimina las tareas terminadas creadas antes de la fecha indicada
+func (r *TaskRepository) PurgeOlderThan(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"status":     bson.M{"$in": models.TerminalStatuses},
+		"created_at": bson.M{"$lt": before},
+	}
+
+	result, err := r.collection.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("error al purgar tareas: %v", err)
+	}
+	return result.DeletedCount, nil
+}
+
+// notMatchedError distingue entre tarea inexistente y tarea en un estado inválido
+func (r *TaskRepository) notMatchedError(ctx context.Context, id primitive.ObjectID) error {
+	task, err := r.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if task == nil {
+		return ErrTaskNotFound
+	}
+	return ErrInvalidState
+}
+
+func (r *TaskRepository) CountAll(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	count, err := r.collection.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return 0, fmt.Errorf("error al contar tareas: %v", err)
+	}
+	return count, nil
+}
+
+func (r *TaskRepository) CountPending(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	filter := pendingFilter()
+
+	count, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("error al contar tareas pendientes: %v", err)
+	}
+	return count, nil
+}
+
+// CountReady cuenta las tareas que un worker con esas opciones (colas, tipos y
+// tags) podría reclamar ahora: pendientes, sin run_at futuro y no bloqueadas por
+// una pausa, un circuit breaker, el rate limit o su clave de concurrencia
+func (r *TaskRepository) CountReady(ctx context.Context, claimOpts ClaimOptions) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	filter, _, err := r.claimFilter(ctx, true)
+	if err != nil {
+		return 0, fmt.Errorf("error al contar tareas listas: %v", err)
+	}
+	claimOpts.restrict(filter)
+
+	count, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("error al contar tareas listas: %v", err)
+	}
+	return count, nil
+}
+
+// Stats retorna el total de tareas y los conteos por estado y por tipo
+func (r *TaskRepository) Stats(ctx context.Context) (*models.TaskStats, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	paused, err := r.pauses.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	breakers, err := r.breakers.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rateLimits, err := r.rateLimits.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stats := &models.TaskStats{
+		ByStatus:   map[string]int64{},
+		ByType:     map[string]int64{},
+		ByQueue:    map[string]int64{},
+		Paused:     paused,
+		Breakers:   breakers,
+		RateLimits: rateLimits,
+	}
+
+	// Un solo aggregate con $facet para ambos agrupamientos
+	pipeline := mongo.Pipeline{
+		{{Key: "$facet", Value: bson.M{
+			"by_status": bson.A{bson.M{"$group": bson.M{"_id": "$status", "count": bson.M{"$sum": 1}}}},
+			"by_type":   bson.A{bson.M{"$group": bson.M{"_id": "$type", "count": bson.M{"$sum": 1}}}},
+			"by_queue":  bson.A{bson.M{"$group": bson.M{"_id": "$queue", "count": bson.M{"$sum": 1}}}},
+		}}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("error al calcular estadísticas: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	type groupCount struct {
+		Key   string `bson:"_id"`
+		Count int64  `bson:"count"`
+	}
+	var facets []struct {
+		ByStatus []groupCount `bson:"by_status"`
+		ByType   []groupCount `bson:"by_type"`
+		ByQueue  []groupCount `bson:"by_queue"`
+	}
+	if err = cursor.All(ctx, &facets); err != nil {
+		return nil, fmt.Errorf("error al decodificar estadísticas: %v", err)
+	}
+	if len(facets) == 0 {
+		return stats, nil
+	}
+
+	for _, group := range facets[0].ByStatus {
+		stats.ByStatus[group.Key] = group.Count
+		stats.Total += group.Count
+	}
+	for _, group := range facets[0].ByType {
+		stats.ByType[group.Key] = group.Count
+	}
+	for _, group := range facets[0].ByQueue {
+		stats.ByQueue[group.Key] = group.Count
+	}
+	return stats, nil
+}
+
+// FindRecentFailures lista las últimas tareas que registraron un error
+func (r *TaskRepository) FindRecentFailures(ctx context.Context, limit int64) ([]*models.Task, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"last_error": bson.M{"$exists": true}}
+	opts := options.Find().SetSort(bson.D{{Key: "failed_at", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error al listar tareas fallidas: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var tasks []*models.Task
+	if err = cursor.All(ctx, &tasks); err != nil {
+		return nil, fmt.Errorf("error al decodificar tareas fallidas: %v", err)
+	}
+	return tasks, nil
+}
+
+// WorkerActivity agrupa por worker las tareas en curso y procesadas
+func (r *TaskRepository) WorkerActivity(ctx context.Context) ([]*models.WorkerActivity, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"claimed_by": bson.M{"$exists": true}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": "$claimed_by",
+			"running": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$status", models.StatusRunning}}, 1, 0,
+			}}},
+			"processed": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$status", models.StatusProcessed}}, 1, 0,
+			}}},
+			"last_claimed_at": bson.M{"$max": "$claimed_at"},
+		}}},
+		{{Key: "$sort", Value: bson.M{"last_claimed_at": -1}}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("error al calcular actividad de workers: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var activity []*models.WorkerActivity
+	if err = cursor.All(ctx, &activity); err != nil {
+		return nil, fmt.Errorf("error al decodificar actividad de workers: %v", err)
+	}
+	return activity, nil
 }
@@ -0,0 +1,224 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"taskProcessor/models"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestClaimBatchNeverSharesTasks(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+
+	const total, batchSize, workers = 40, 3, 4
+	tasks := make([]*models.Task, total)
+	for i := range tasks {
+		tasks[i] = models.NewTask("send_email", fmt.Sprintf("Email %d", i), nil)
+	}
+	if itemErrors, err := repo.CreateMany(ctx, tasks); err != nil {
+		t.Fatal(err)
+	} else {
+		for _, itemErr := range itemErrors {
+			if itemErr != nil {
+				t.Fatal(itemErr)
+			}
+		}
+	}
+
+	var (
+		mu        sync.Mutex
+		claimedBy = map[primitive.ObjectID]string{}
+		claimed   int
+	)
+	deadline := time.Now().Add(10 * time.Second)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		workerID := fmt.Sprintf("worker-%d", w)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			for time.Now().Before(deadline) {
+				mu.Lock()
+				done := claimed == total
+				mu.Unlock()
+				if done {
+					return
+				}
+
+				batch, err := repo.ClaimBatch(ctx, workerID, batchSize)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if len(batch) > batchSize {
+					t.Errorf("%s recibió %d tareas, el máximo es %d", workerID, len(batch), batchSize)
+				}
+
+				mu.Lock()
+				for _, task := range batch {
+					if task.ClaimedBy != workerID || task.Status != models.StatusRunning {
+						t.Errorf("tarea %s entregada a %s con claimed_by %q y estado %s", task.ID.Hex(), workerID, task.ClaimedBy, task.Status)
+					}
+					if previous, ok := claimedBy[task.ID]; ok {
+						t.Errorf("la tarea %s se entregó a %s y a %s", task.ID.Hex(), previous, workerID)
+					}
+					claimedBy[task.ID] = workerID
+				}
+				claimed = len(claimedBy)
+				mu.Unlock()
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if len(claimedBy) != total {
+		t.Fatalf("se reclamaron %d tareas de %d", len(claimedBy), total)
+	}
+	if batch, err := repo.ClaimBatch(ctx, "worker-extra", batchSize); err != nil || len(batch) != 0 {
+		t.Errorf("no deben quedar tareas: %d (%v)", len(batch), err)
+	}
+}
+
+func TestBackfillStatus(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+
+	// Documentos como los guardaba la versión sin status
+	processedAt := primitive.NewDateTimeFromTime(time.Now())
+	legacyPending := bson.M{"_id": primitive.NewObjectID(), "title": "Vieja pendiente", "processed": false, "attempts": 0, "created_at": time.Now()}
+	legacyProcessed := bson.M{"_id": primitive.NewObjectID(), "title": "Vieja procesada", "processed": true, "attempts": 1, "processed_at": processedAt, "created_at": time.Now()}
+	current := models.NewTask("send_email", "Nueva", nil)
+	current.Queue = "emails"
+	if _, err := repo.collection.InsertMany(ctx, []interface{}{legacyPending, legacyProcessed, current}); err != nil {
+		t.Fatal(err)
+	}
+
+	migrated, err := repo.BackfillStatus(ctx)
+	if err != nil || migrated != 2 {
+		t.Fatalf("se migraron %d tareas (%v), se esperaban 2", migrated, err)
+	}
+	if migrated, err := repo.BackfillStatus(ctx); err != nil || migrated != 0 {
+		t.Errorf("la segunda pasada migró %d tareas (%v)", migrated, err)
+	}
+
+	expected := map[primitive.ObjectID]string{
+		legacyPending["_id"].(primitive.ObjectID):   models.StatusPending,
+		legacyProcessed["_id"].(primitive.ObjectID): models.StatusProcessed,
+		current.ID: models.StatusPending,
+	}
+	for id, status := range expected {
+		task, err := repo.GetByID(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if task.Status != status || task.Queue == "" || task.MaxAttempts == 0 {
+			t.Errorf("tarea %s: status %q, queue %q, max_attempts %d", task.Title, task.Status, task.Queue, task.MaxAttempts)
+		}
+	}
+	if task, _ := repo.GetByID(ctx, current.ID); task.Queue != "emails" {
+		t.Errorf("no debe tocar tareas con status: queue %q", task.Queue)
+	}
+
+	// La pendiente vuelve a contarse y a poder reclamarse
+	stats, err := repo.Stats(ctx)
+	if err != nil || stats.ByStatus[models.StatusPending] != 2 || stats.ByStatus[models.StatusProcessed] != 1 {
+		t.Errorf("stats = %+v (%v)", stats, err)
+	}
+	claimed := map[primitive.ObjectID]bool{}
+	for i := 0; i < 3; i++ {
+		task, err := repo.ClaimTask(ctx, "worker-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if task == nil {
+			break
+		}
+		claimed[task.ID] = true
+	}
+	if !claimed[legacyPending["_id"].(primitive.ObjectID)] || len(claimed) != 2 {
+		t.Errorf("se reclamaron %v, se esperaba la pendiente antigua y la nueva", claimed)
+	}
+}
+
+func TestClaimOnlyRegisteredTypes(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+
+	image := models.NewTask("process_image", "Imagen", nil)
+	email := models.NewTask("send_email", "Email", nil)
+	for _, task := range []*models.Task{image, email} {
+		if err := repo.Create(ctx, task); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Un pool que solo procesa emails nunca toma la imagen, aunque sea más vieja
+	claimOpts := ClaimOptions{Types: []string{"send_email"}}
+	if ready, err := repo.CountReady(ctx, claimOpts); err != nil || ready != 1 {
+		t.Errorf("CountReady = %d (%v), se esperaba 1", ready, err)
+	}
+	claimed, err := repo.ClaimTaskWithOptions(ctx, "worker-emails", claimOpts)
+	if err != nil || claimed == nil || claimed.ID != email.ID {
+		t.Fatalf("se reclamó %v (%v), se esperaba el email", claimed, err)
+	}
+	if claimed, err := repo.ClaimTaskWithOptions(ctx, "worker-emails", claimOpts); err != nil || claimed != nil {
+		t.Fatalf("se reclamó %v (%v), la imagen es de otro pool", claimed, err)
+	}
+
+	task, err := repo.GetByID(ctx, image.ID)
+	if err != nil || task.Status != models.StatusPending || task.Attempts != 0 {
+		t.Errorf("la imagen debe seguir pendiente: %+v (%v)", task, err)
+	}
+}
+
+func TestEventsSinceUsesRecentEvents(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+
+	// Idempotente: se llama en cada arranque
+	for i := 0; i < 2; i++ {
+		if err := repo.EnsureIndexes(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	specs, err := repo.collection.Indexes().ListSpecifications(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexed := false
+	for _, spec := range specs {
+		indexed = indexed || spec.Name == "events.at_1"
+	}
+	if !indexed {
+		t.Errorf("falta el índice de events.at: %v", specs)
+	}
+
+	old := models.NewTask("send_email", "Vieja", nil)
+	old.Events = []models.TaskEvent{models.NewTaskEvent(models.EventCreated, "", "")}
+	old.Events[0].At = time.Now().Add(-time.Hour)
+	if _, err := repo.collection.InsertOne(ctx, old); err != nil {
+		t.Fatal(err)
+	}
+	since := time.Now().Add(-time.Minute)
+	recent := models.NewTask("send_email", "Nueva", nil)
+	if err := repo.Create(ctx, recent); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := repo.EventsSince(ctx, since, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].TaskID != recent.ID.Hex() || found[0].Type != models.EventCreated {
+		t.Errorf("eventos = %+v, se esperaba solo el created de la tarea nueva", found)
+	}
+}
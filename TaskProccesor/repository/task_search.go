@@ -0,0 +1,290 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"taskProcessor/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrInvalidQuery se retorna cuando los filtros, el orden o el cursor de una búsqueda no son válidos
+var ErrInvalidQuery = errors.New("búsqueda inválida")
+
+// Límites de la página de Search
+const (
+	DefaultSearchLimit = 50
+	MaxSearchLimit     = 500
+)
+
+// SortFields campos por los que se puede ordenar una búsqueda
+var SortFields = []string{"created_at", "processed_at", "attempts", "type", "status", "queue"}
+
+// TaskQuery filtros, orden y página de Search. Los campos vacíos no filtran.
+type TaskQuery struct {
+	Statuses        []string
+	Types           []string
+	Queues          []string
+	WorkerID        string // Worker que la tiene o la tuvo reclamada (claimed_by)
+	CreatedAfter    *time.Time
+	CreatedBefore   *time.Time // Exclusivo
+	ProcessedAfter  *time.Time
+	ProcessedBefore *time.Time // Exclusivo
+	MinAttempts     *int
+	MaxAttempts     *int
+	TitleContains   string            // Sin distinguir mayúsculas
+	Payload         map[string]string // payload.<campo> == valor; "12345" también matchea el número 12345
+
+	SortBy     string // Uno de SortFields (vacío = created_at)
+	Descending bool
+	Limit      int64  // 0 = DefaultSearchLimit, tope MaxSearchLimit
+	Cursor     string // NextCursor de la página anterior
+}
+
+// TaskPage una página de resultados de Search
+type TaskPage struct {
+	Tasks      []*models.Task `json:"tasks"`
+	NextCursor string         `json:"next_cursor,omitempty"` // Vacío = no hay más páginas
+}
+
+// searchCursor posición después de la última tarea de una página: su valor en el
+// campo de orden y su _id para desempatar. Se codifica en BSON (conserva el tipo
+// del valor) y base64 URL.
+type searchCursor struct {
+	SortBy     string             `bson:"s"`
+	Descending bool               `bson:"d"`
+	Value      interface{}        `bson:"v"`
+	ID         primitive.ObjectID `bson:"id"`
+}
+
+// Search busca tareas con filtros combinables y paginación por cursor. El orden es
+// estable (desempata por _id), así una página no repite ni saltea tareas aunque se
+// inserten nuevas mientras se recorre.
+func (r *TaskRepository) Search(ctx context.Context, query TaskQuery) (*TaskPage, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter, err := query.filter()
+	if err != nil {
+		return nil, err
+	}
+
+	sortBy := query.SortBy
+	if sortBy == "" {
+		sortBy = "created_at"
+	}
+	if !slices.Contains(SortFields, sortBy) {
+		return nil, fmt.Errorf("%w: no se puede ordenar por %q (usar %s)", ErrInvalidQuery, sortBy, strings.Join(SortFields, ", "))
+	}
+	direction := 1
+	if query.Descending {
+		direction = -1
+	}
+
+	if query.Cursor != "" {
+		cursor, err := decodeSearchCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.SortBy != sortBy || cursor.Descending != query.Descending {
+			return nil, fmt.Errorf("%w: el cursor es de una búsqueda con otro orden", ErrInvalidQuery)
+		}
+		filter = bson.M{"$and": bson.A{filter, afterCursor(cursor)}}
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	limit = min(limit, MaxSearchLimit)
+
+	// Se pide una de más para saber si hay otra página
+	opts := options.Find().
+		SetSort(bson.D{{Key: sortBy, Value: direction}, {Key: "_id", Value: direction}}).
+		SetLimit(limit + 1).
+		SetProjection(bson.M{"events": 0, "pending_children": 0})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error al buscar tareas: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	tasks := []*models.Task{}
+	if err = cursor.All(ctx, &tasks); err != nil {
+		return nil, fmt.Errorf("error al decodificar tareas: %v", err)
+	}
+
+	page := &TaskPage{Tasks: tasks}
+	if int64(len(tasks)) > limit {
+		page.Tasks = tasks[:limit]
+		last := page.Tasks[limit-1]
+		page.NextCursor, err = encodeSearchCursor(searchCursor{
+			SortBy:     sortBy,
+			Descending: query.Descending,
+			Value:      sortValue(last, sortBy),
+			ID:         last.ID,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
+
+// filter arma el filtro de MongoDB de la búsqueda
+func (query TaskQuery) filter() (bson.M, error) {
+	filter := bson.M{}
+
+	for _, status := range query.Statuses {
+		if !slices.Contains(models.Statuses, status) {
+			return nil, fmt.Errorf("%w: estado desconocido %q", ErrInvalidQuery, status)
+		}
+	}
+	if len(query.Statuses) > 0 {
+		filter["status"] = bson.M{"$in": query.Statuses}
+	}
+	if len(query.Types) > 0 {
+		filter["type"] = bson.M{"$in": query.Types}
+	}
+	if len(query.Queues) > 0 {
+		filter["queue"] = bson.M{"$in": query.Queues}
+	}
+	if query.WorkerID != "" {
+		filter["claimed_by"] = query.WorkerID
+	}
+
+	if createdAt := timeRange(query.CreatedAfter, query.CreatedBefore); createdAt != nil {
+		filter["created_at"] = createdAt
+	}
+	if processedAt := timeRange(query.ProcessedAfter, query.ProcessedBefore); processedAt != nil {
+		filter["processed_at"] = processedAt
+	}
+
+	attempts := bson.M{}
+	if query.MinAttempts != nil {
+		attempts["$gte"] = *query.MinAttempts
+	}
+	if query.MaxAttempts != nil {
+		attempts["$lte"] = *query.MaxAttempts
+	}
+	if len(attempts) > 0 {
+		filter["attempts"] = attempts
+	}
+
+	if query.TitleContains != "" {
+		filter["title"] = bson.M{"$regex": regexp.QuoteMeta(query.TitleContains), "$options": "i"}
+	}
+
+	for field, value := range query.Payload {
+		if field == "" || strings.Contains(field, "$") || strings.HasPrefix(field, ".") || strings.HasSuffix(field, ".") {
+			return nil, fmt.Errorf("%w: campo de payload inválido %q", ErrInvalidQuery, field)
+		}
+		filter["payload."+field] = bson.M{"$in": payloadValues(value)}
+	}
+	return filter, nil
+}
+
+// timeRange condición [after, before) sobre una fecha (nil si no hay límites)
+func timeRange(after, before *time.Time) bson.M {
+	condition := bson.M{}
+	if after != nil {
+		condition["$gte"] = *after
+	}
+	if before != nil {
+		condition["$lt"] = *before
+	}
+	if len(condition) == 0 {
+		return nil
+	}
+	return condition
+}
+
+// payloadValues valores que puede tener en el payload un campo pedido como texto:
+// el texto tal cual y, si lo parece, el número o booleano equivalente
+func payloadValues(value string) bson.A {
+	values := bson.A{value}
+	if number, err := strconv.ParseInt(value, 10, 64); err == nil {
+		values = append(values, number)
+	} else if number, err := strconv.ParseFloat(value, 64); err == nil {
+		values = append(values, number)
+	}
+	if value == "true" || value == "false" {
+		values = append(values, value == "true")
+	}
+	return values
+}
+
+// sortValue valor de la tarea en el campo de orden, tal como está en MongoDB
+func sortValue(task *models.Task, sortBy string) interface{} {
+	switch sortBy {
+	case "processed_at":
+		if task.ProcessedAt == nil {
+			return nil
+		}
+		return *task.ProcessedAt
+	case "attempts":
+		return task.Attempts
+	case "type":
+		return task.Type
+	case "status":
+		return task.Status
+	case "queue":
+		return task.Queue
+	default:
+		return task.CreatedAt
+	}
+}
+
+// afterCursor condición de las tareas que van después del cursor en su orden.
+// Sin el campo (processed_at de una tarea no terminada) MongoDB lo trata como
+// null, que va antes que cualquier valor; $gt/$lt no comparan contra null, por
+// eso ese caso se arma aparte.
+func afterCursor(cursor *searchCursor) bson.M {
+	field := cursor.SortBy
+	idOp, valueOp := "$gt", "$gt"
+	if cursor.Descending {
+		idOp, valueOp = "$lt", "$lt"
+	}
+	sameValue := bson.M{field: cursor.Value, "_id": bson.M{idOp: cursor.ID}}
+
+	switch {
+	case cursor.Value == nil && !cursor.Descending:
+		return bson.M{"$or": bson.A{bson.M{field: bson.M{"$ne": nil}}, sameValue}}
+	case cursor.Value == nil:
+		return sameValue
+	case cursor.Descending:
+		return bson.M{"$or": bson.A{bson.M{field: bson.M{valueOp: cursor.Value}}, sameValue, bson.M{field: nil}}}
+	default:
+		return bson.M{"$or": bson.A{bson.M{field: bson.M{valueOp: cursor.Value}}, sameValue}}
+	}
+}
+
+func encodeSearchCursor(cursor searchCursor) (string, error) {
+	data, err := bson.Marshal(cursor)
+	if err != nil {
+		return "", fmt.Errorf("error al codificar el cursor: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeSearchCursor(encoded string) (*searchCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: cursor mal formado", ErrInvalidQuery)
+	}
+	var cursor searchCursor
+	if err := bson.Unmarshal(data, &cursor); err != nil || cursor.ID.IsZero() {
+		return nil, fmt.Errorf("%w: cursor mal formado", ErrInvalidQuery)
+	}
+	return &cursor, nil
+}
@@ -0,0 +1,227 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"taskProcessor/models"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSearchCursorRoundTrip(t *testing.T) {
+	createdAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	cursor := searchCursor{SortBy: "created_at", Descending: true, Value: createdAt, ID: primitive.NewObjectID()}
+
+	encoded, err := encodeSearchCursor(cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := decodeSearchCursor(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.SortBy != cursor.SortBy || decoded.Descending != cursor.Descending || decoded.ID != cursor.ID {
+		t.Errorf("cursor = %+v, se esperaba %+v", decoded, cursor)
+	}
+	// El valor conserva su tipo BSON para compararlo en MongoDB
+	if value, ok := decoded.Value.(primitive.DateTime); !ok || !value.Time().Equal(createdAt) {
+		t.Errorf("valor = %#v, se esperaba la fecha %v", decoded.Value, createdAt)
+	}
+}
+
+func TestSearchRejectsInvalidQueries(t *testing.T) {
+	repo := offlineRepository(t)
+	otherOrder, err := encodeSearchCursor(searchCursor{SortBy: "attempts", Value: 2, ID: primitive.NewObjectID()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	noID, err := bson.Marshal(bson.M{"s": "created_at"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]TaskQuery{
+		"cursor que no es base64":   {Cursor: "no es un cursor!"},
+		"cursor que no es BSON":     {Cursor: "aG9sYQ"},
+		"cursor sin _id":            {Cursor: base64.RawURLEncoding.EncodeToString(noID)},
+		"cursor de otro orden":      {Cursor: otherOrder},
+		"estado desconocido":        {Statuses: []string{"pending", "terminada"}},
+		"orden desconocido":         {SortBy: "payload"},
+		"campo de payload inválido": {Payload: map[string]string{"$where": "1"}},
+	}
+	for name, query := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Falla antes de consultar MongoDB: el repositorio no tiene servidor
+			if _, err := repo.Search(context.Background(), query); !errors.Is(err, ErrInvalidQuery) {
+				t.Errorf("error = %v, se esperaba ErrInvalidQuery", err)
+			}
+		})
+	}
+}
+
+func TestTaskQueryFilter(t *testing.T) {
+	after := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	minAttempts := 2
+	filter, err := TaskQuery{
+		Statuses:      []string{models.StatusDead},
+		Types:         []string{"send_email", "process_image"},
+		CreatedAfter:  &after,
+		MinAttempts:   &minAttempts,
+		TitleContains: "a.b",
+		Payload:       map[string]string{"user_id": "12345", "urgent": "true"},
+	}.filter()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := bson.M{
+		"status":          bson.M{"$in": []string{models.StatusDead}},
+		"type":            bson.M{"$in": []string{"send_email", "process_image"}},
+		"created_at":      bson.M{"$gte": after},
+		"attempts":        bson.M{"$gte": 2},
+		"title":           bson.M{"$regex": `a\.b`, "$options": "i"},
+		"payload.user_id": bson.M{"$in": bson.A{"12345", int64(12345)}},
+		"payload.urgent":  bson.M{"$in": bson.A{"true", true}},
+	}
+	if !reflect.DeepEqual(filter, expected) {
+		t.Errorf("filtro = %v\nse esperaba %v", filter, expected)
+	}
+}
+
+// searchAll recorre todas las páginas de una búsqueda y retorna los IDs en orden
+func searchAll(t *testing.T, repo *TaskRepository, query TaskQuery) []primitive.ObjectID {
+	t.Helper()
+	var ids []primitive.ObjectID
+	for pages := 0; ; pages++ {
+		if pages > 100 {
+			t.Fatal("la paginación no termina")
+		}
+		page, err := repo.Search(context.Background(), query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int64(len(page.Tasks)) > query.Limit {
+			t.Fatalf("la página tiene %d tareas, el límite es %d", len(page.Tasks), query.Limit)
+		}
+		for _, task := range page.Tasks {
+			ids = append(ids, task.ID)
+		}
+		if page.NextCursor == "" {
+			return ids
+		}
+		query.Cursor = page.NextCursor
+	}
+}
+
+func TestSearchPagesThroughTies(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+
+	// Todas con el mismo created_at: el orden y los cursores dependen del desempate por _id.
+	// Algunas terminadas para cubrir processed_at ausente (null) y presente.
+	createdAt := time.Now().Truncate(time.Millisecond)
+	processedAt := primitive.NewDateTimeFromTime(createdAt.Add(time.Minute))
+	var documents []interface{}
+	var ids []primitive.ObjectID
+	for i := 0; i < 10; i++ {
+		task := models.NewTask("send_email", fmt.Sprintf("Email %d", i), nil)
+		task.CreatedAt = createdAt
+		if i%3 == 0 {
+			task.Status = models.StatusProcessed
+			task.ProcessedAt = &processedAt
+		}
+		documents = append(documents, task)
+		ids = append(ids, task.ID)
+	}
+	if _, err := repo.collection.InsertMany(ctx, documents); err != nil {
+		t.Fatal(err)
+	}
+	slices.SortFunc(ids, func(a, b primitive.ObjectID) int { return slices.Compare(a[:], b[:]) })
+	reversed := slices.Clone(ids)
+	slices.Reverse(reversed)
+
+	for _, sortBy := range []string{"created_at", "processed_at"} {
+		for _, descending := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s descendente=%v", sortBy, descending), func(t *testing.T) {
+				got := searchAll(t, repo, TaskQuery{SortBy: sortBy, Descending: descending, Limit: 3})
+				if len(got) != len(ids) {
+					t.Fatalf("se recorrieron %d tareas de %d: %v", len(got), len(ids), got)
+				}
+				seen := map[primitive.ObjectID]bool{}
+				for _, id := range got {
+					if seen[id] {
+						t.Fatalf("la tarea %s aparece dos veces", id.Hex())
+					}
+					seen[id] = true
+				}
+				if sortBy == "created_at" {
+					expected := ids
+					if descending {
+						expected = reversed
+					}
+					if !slices.Equal(got, expected) {
+						t.Errorf("orden = %v, se esperaba %v", got, expected)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestSearchCombinedFilters(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+
+	newTask := func(taskType, title, status string, attempts int, payload map[string]interface{}) *models.Task {
+		task := models.NewTask(taskType, title, payload)
+		task.Status = status
+		task.Attempts = attempts
+		return task
+	}
+	match := newTask("send_email", "Email de Bienvenida", models.StatusDead, 3, map[string]interface{}{"user_id": 12345})
+	matchString := newTask("send_email", "Bienvenida otra vez", models.StatusDead, 2, map[string]interface{}{"user_id": "12345"})
+	tasks := []*models.Task{
+		match,
+		matchString,
+		newTask("send_email", "Email de bienvenida", models.StatusDead, 1, map[string]interface{}{"user_id": 12345}),      // Pocos intentos
+		newTask("send_email", "Email de bienvenida", models.StatusProcessed, 3, map[string]interface{}{"user_id": 12345}), // Otro estado
+		newTask("process_image", "Bienvenida", models.StatusDead, 3, map[string]interface{}{"user_id": 12345}),            // Otro tipo
+		newTask("send_email", "Recordatorio", models.StatusDead, 3, map[string]interface{}{"user_id": 12345}),             // Otro título
+		newTask("send_email", "Email de bienvenida", models.StatusDead, 3, map[string]interface{}{"user_id": 999}),        // Otro usuario
+	}
+	var documents []interface{}
+	for _, task := range tasks {
+		documents = append(documents, task)
+	}
+	if _, err := repo.collection.InsertMany(ctx, documents); err != nil {
+		t.Fatal(err)
+	}
+
+	minAttempts := 2
+	page, err := repo.Search(ctx, TaskQuery{
+		Statuses:      []string{models.StatusDead},
+		Types:         []string{"send_email"},
+		MinAttempts:   &minAttempts,
+		TitleContains: "bienvenida",
+		Payload:       map[string]string{"user_id": "12345"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []primitive.ObjectID
+	for _, task := range page.Tasks {
+		got = append(got, task.ID)
+	}
+	expected := []primitive.ObjectID{match.ID, matchString.ID}
+	if !slices.Equal(got, expected) || page.NextCursor != "" {
+		t.Errorf("resultado = %v (cursor %q), se esperaba %v", got, page.NextCursor, expected)
+	}
+}
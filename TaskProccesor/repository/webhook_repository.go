@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"taskProcessor/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// WebhookRepository registros de entrega de webhooks
+type WebhookRepository struct {
+	collection *mongo.Collection
+}
+
+func NewWebhookRepository(collection *mongo.Collection) *WebhookRepository {
+	return &WebhookRepository{
+		collection: collection,
+	}
+}
+
+// Record guarda un intento de entrega
+func (r *WebhookRepository) Record(ctx context.Context, delivery *models.WebhookDelivery) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if delivery.ID.IsZero() {
+		delivery.ID = primitive.NewObjectID()
+	}
+	if delivery.DeliveredAt.IsZero() {
+		delivery.DeliveredAt = time.Now()
+	}
+	if _, err := r.collection.InsertOne(ctx, delivery); err != nil {
+		return fmt.Errorf("error al registrar entrega de webhook: %v", err)
+	}
+	return nil
+}
+
+// ListByTask retorna los intentos de entrega del webhook de una tarea, del más nuevo al más viejo
+func (r *WebhookRepository) ListByTask(ctx context.Context, taskID primitive.ObjectID, limit int64) ([]*models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "delivered_at", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	cursor, err := r.collection.Find(ctx, bson.M{"task_id": taskID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error al listar entregas de webhook: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	deliveries := []*models.WebhookDelivery{}
+	if err = cursor.All(ctx, &deliveries); err != nil {
+		return nil, fmt.Errorf("error al decodificar entregas de webhook: %v", err)
+	}
+	return deliveries, nil
+}
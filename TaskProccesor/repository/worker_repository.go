@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"taskProcessor/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// WorkerRepository registro de pools de workers y sus heartbeats
+type WorkerRepository struct {
+	collection *mongo.Collection
+}
+
+func NewWorkerRepository(collection *mongo.Collection) *WorkerRepository {
+	return &WorkerRepository{
+		collection: collection,
+	}
+}
+
+// Register registra (o re-registra) un pool de workers
+func (r *WorkerRepository) Register(ctx context.Context, worker *models.Worker) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	if worker.StartedAt.IsZero() {
+		worker.StartedAt = now
+	}
+	worker.LastHeartbeat = now
+	if worker.Running == nil {
+		worker.Running = []models.RunningTask{}
+	}
+
+	opts := options.Replace().SetUpsert(true)
+	if _, err := r.collection.ReplaceOne(ctx, bson.M{"_id": worker.ID}, worker, opts); err != nil {
+		return fmt.Errorf("error al registrar worker: %v", err)
+	}
+	return nil
+}
+
+// Heartbeat actualiza el último latido del pool, su cantidad de workers (cambia con
+// el autoscaling) y las tareas que está ejecutando.
+// Retorna false si el pool ya no está registrado (por ejemplo, el reaper lo dio por muerto).
+func (r *WorkerRepository) Heartbeat(ctx context.Context, id string, concurrency int, running []models.RunningTask) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if running == nil {
+		running = []models.RunningTask{}
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"last_heartbeat": time.Now(),
+			"concurrency":    concurrency,
+			"running":        running,
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return false, fmt.Errorf("error al enviar heartbeat: %v", err)
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// Deregister elimina el registro de un pool que se detuvo de forma ordenada
+func (r *WorkerRepository) Deregister(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if _, err := r.collection.DeleteOne(ctx, bson.M{"_id": id}); err != nil {
+		return fmt.Errorf("error al eliminar worker: %v", err)
+	}
+	return nil
+}
+
+// List retorna los pools registrados, del más nuevo al más viejo
+func (r *WorkerRepository) List(ctx context.Context) ([]*models.Worker, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "started_at", Value: -1}})
+	cursor, err := r.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error al listar workers: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	workers := []*models.Worker{}
+	if err = cursor.All(ctx, &workers); err != nil {
+		return nil, fmt.Errorf("error al decodificar workers: %v", err)
+	}
+	return workers, nil
+}
+
+// RemoveStale elimina los pools sin heartbeat desde hace más de staleAfter
+// y retorna sus IDs para que se liberen sus tareas.
+func (r *WorkerRepository) RemoveStale(ctx context.Context, staleAfter time.Duration) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"last_heartbeat": bson.M{"$lt": time.Now().Add(-staleAfter)}}
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("error al buscar workers muertos: %v", err)
+	}
+	var stale []struct {
+		ID string `bson:"_id"`
+	}
+	if err = cursor.All(ctx, &stale); err != nil {
+		return nil, fmt.Errorf("error al decodificar workers muertos: %v", err)
+	}
+
+	var removed []string
+	for _, worker := range stale {
+		// Se vuelve a chequear el heartbeat: si el pool revivió entre el Find
+		// y el borrado, no se elimina
+		result, err := r.collection.DeleteOne(ctx, bson.M{"_id": worker.ID, "last_heartbeat": filter["last_heartbeat"]})
+		if err != nil {
+			return removed, fmt.Errorf("error al eliminar worker %s: %v", worker.ID, err)
+		}
+		if result.DeletedCount > 0 {
+			removed = append(removed, worker.ID)
+		}
+	}
+	return removed, nil
+}
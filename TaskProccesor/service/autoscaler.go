@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"taskProcessor/models"
+	"time"
+)
+
+// scaleWindow mediciones acumuladas desde la última evaluación del autoscaling
+type scaleWindow struct {
+	waitTotal    time.Duration
+	waits        int
+	latencyTotal time.Duration
+	latencies    int
+}
+
+// autoscaling indica si el pool escala entre MinWorkers y MaxWorkers
+func (p *WorkerPool) autoscaling() bool {
+	return p.config.MaxWorkers > 0
+}
+
+// startWorker lanza un worker más
+func (p *WorkerPool) startWorker() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.nextWorker++
+	stop := make(chan struct{})
+	p.stops = append(p.stops, stop)
+	p.metrics.workers.Store(int64(len(p.stops)))
+
+	p.wg.Add(1)
+	go p.runWorker(p.ctx, fmt.Sprintf("%s/%d", p.id, p.nextWorker), stop)
+}
+
+// stopWorker detiene el último worker lanzado cuando termine su tarea actual
+func (p *WorkerPool) stopWorker() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	last := len(p.stops) - 1
+	close(p.stops[last])
+	p.stops = p.stops[:last]
+	p.metrics.workers.Store(int64(len(p.stops)))
+}
+
+// workerCount cantidad de workers vivos
+func (p *WorkerPool) workerCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.stops)
+}
+
+// observeWait registra cuánto esperó la tarea desde que estuvo lista hasta que se reclamó
+func (p *WorkerPool) observeWait(task *models.Task) {
+	if !p.autoscaling() {
+		return
+	}
+	readyAt := task.CreatedAt
+	if task.RunAt != nil && task.RunAt.After(readyAt) {
+		readyAt = *task.RunAt
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.window.waitTotal += max(0, time.Since(readyAt))
+	p.window.waits++
+}
+
+// observeLatency registra la duración de una ejecución del handler
+func (p *WorkerPool) observeLatency(d time.Duration) {
+	if !p.autoscaling() {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.window.latencyTotal += d
+	p.window.latencies++
+}
+
+// takeWindow retorna las mediciones acumuladas y empieza una ventana nueva
+func (p *WorkerPool) takeWindow() scaleWindow {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	window := p.window
+	p.window = scaleWindow{}
+	return window
+}
+
+// runAutoscaler cada ScaleInterval ajusta la cantidad de workers según las tareas
+// listas para reclamar, la espera observada y la latencia de los handlers
+func (p *WorkerPool) runAutoscaler(ctx context.Context) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.config.ScaleInterval)
+	defer ticker.Stop()
+
+	var lastScaleUp, lastScale time.Time
+	var latency time.Duration // Última latencia media conocida
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		ready, err := p.repo.CountReady(ctx, p.claimOptions())
+		if err != nil {
+			log.Printf("❌ Autoscaling: %v", err)
+			continue
+		}
+		window := p.takeWindow()
+		var wait time.Duration
+		if window.waits > 0 {
+			wait = window.waitTotal / time.Duration(window.waits)
+		}
+		if window.latencies > 0 {
+			latency = window.latencyTotal / time.Duration(window.latencies)
+		}
+		p.metrics.readyTasks.Store(ready)
+		p.metrics.avgWait.Store(int64(wait))
+		p.metrics.avgLatency.Store(int64(latency))
+
+		current := p.workerCount()
+		busy := len(p.runningTasks())
+		desired := desiredWorkers(p.config, current, busy, ready, wait, latency)
+		now := time.Now()
+
+		switch {
+		case desired > current && now.Sub(lastScaleUp) >= p.config.ScaleUpCooldown:
+			for i := current; i < desired; i++ {
+				p.startWorker()
+			}
+			lastScaleUp, lastScale = now, now
+			p.metrics.scaleUps.Add(1)
+			log.Printf("📈 Autoscaling: %d → %d workers (listas=%d, ocupados=%d, espera=%v, latencia=%v)",
+				current, desired, ready, busy, wait.Round(time.Millisecond), latency.Round(time.Millisecond))
+
+		case desired < current && now.Sub(lastScale) >= p.config.ScaleDownCooldown:
+			// Se achica de a mitades: una cola que se vació un momento no deja al pool en el mínimo
+			target := current - max(1, (current-desired)/2)
+			for i := target; i < current; i++ {
+				p.stopWorker()
+			}
+			lastScale = now
+			p.metrics.scaleDowns.Add(1)
+			log.Printf("📉 Autoscaling: %d → %d workers (listas=%d, ocupados=%d, espera=%v, latencia=%v)",
+				current, target, ready, busy, wait.Round(time.Millisecond), latency.Round(time.Millisecond))
+		}
+	}
+}
+
+// desiredWorkers workers necesarios para que las tareas listas no esperen más de
+// TargetWait: los ocupados más los que vacían la cola en ese plazo a la latencia
+// observada. Si las tareas ya esperan más de lo aceptable, al menos uno más.
+func desiredWorkers(config PoolConfig, current, busy int, ready int64, wait, latency time.Duration) int {
+	if latency <= 0 {
+		latency = config.TargetWait // Sin mediciones: un worker por tarea lista
+	}
+	needed := busy + int(math.Ceil(float64(ready)*float64(latency)/float64(config.TargetWait)))
+	if ready > 0 && wait > config.TargetWait {
+		needed = max(needed, current+1)
+	}
+	return min(max(needed, config.MinWorkers), config.MaxWorkers)
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"log"
+	"taskProcessor/repository"
+	"time"
+)
+
+// callbackBatchSize tareas terminadas que se revisan por vuelta
+const callbackBatchSize = 100
+
+// CallbackDispatcher encola una tarea "webhook" por cada tarea con callback_url
+// que llega a un estado terminal. La entrega en sí la hace el worker pool, con
+// reintentos y backoff como cualquier otra tarea.
+type CallbackDispatcher struct {
+	repo     *repository.TaskRepository
+	interval time.Duration
+}
+
+func NewCallbackDispatcher(repo *repository.TaskRepository, interval time.Duration) *CallbackDispatcher {
+	return &CallbackDispatcher{
+		repo:     repo,
+		interval: interval,
+	}
+}
+
+// Run revisa cada interval hasta que se cancele el contexto
+func (d *CallbackDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		enqueued, err := d.repo.EnqueueCallbacks(ctx, callbackBatchSize)
+		if err != nil {
+			log.Printf("❌ %v", err)
+		} else if enqueued > 0 {
+			log.Printf("📮 %d webhooks encolados", enqueued)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"taskProcessor/models"
+	"taskProcessor/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrNoCheckpointer se retorna si SaveCheckpoint se llama con un contexto que no
+// viene del worker pool (por ejemplo, al probar un handler por separado)
+var ErrNoCheckpointer = errors.New("el contexto no pertenece a una tarea del worker pool")
+
+// checkpointer guarda checkpoints de la tarea que está ejecutando un worker
+type checkpointer struct {
+	repo     *repository.TaskRepository
+	taskID   primitive.ObjectID
+	workerID string
+}
+
+type checkpointerKey struct{}
+
+// withCheckpointer agrega al contexto del handler lo necesario para SaveCheckpoint
+func withCheckpointer(ctx context.Context, repo *repository.TaskRepository, taskID primitive.ObjectID, workerID string) context.Context {
+	return context.WithValue(ctx, checkpointerKey{}, &checkpointer{repo: repo, taskID: taskID, workerID: workerID})
+}
+
+// SaveCheckpoint guarda state (codificado como JSON) en el documento de la tarea que
+// se está ejecutando, para que el próximo intento retome desde ahí. Solo funciona
+// mientras el worker siga siendo dueño de la tarea: si perdió el lease retorna
+// repository.ErrTaskNotOwned y el handler debería abandonar el intento.
+func SaveCheckpoint(ctx context.Context, state interface{}) error {
+	saver, ok := ctx.Value(checkpointerKey{}).(*checkpointer)
+	if !ok {
+		return ErrNoCheckpointer
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("error al codificar checkpoint: %v", err)
+	}
+	return saver.repo.SaveCheckpoint(ctx, saver.taskID, saver.workerID, data)
+}
+
+// LoadCheckpoint decodifica en state el último checkpoint de la tarea. Retorna
+// false si no hay (primer intento o ningún intento anterior llegó a guardar).
+func LoadCheckpoint(task *models.Task, state interface{}) (bool, error) {
+	if task.Checkpoint == nil || len(task.Checkpoint.Data) == 0 {
+		return false, nil
+	}
+	if err := json.Unmarshal(task.Checkpoint.Data, state); err != nil {
+		return false, Permanent(fmt.Errorf("checkpoint inválido: %v", err))
+	}
+	return true, nil
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"log"
+	"taskProcessor/events"
+	"taskProcessor/repository"
+	"time"
+)
+
+// eventPollerBatch eventos que se leen por vuelta
+const eventPollerBatch = 500
+
+// eventPollerOverlap margen hacia atrás de cada consulta, para no perder eventos
+// de procesos con el reloj un poco atrasado (el bus descarta los repetidos)
+const eventPollerOverlap = 5 * time.Second
+
+// EventPoller publica en el bus los eventos del historial que escribieron otros
+// procesos (u operaciones masivas como el reaper), leyéndolos de MongoDB cada
+// interval. Solo consulta mientras haya suscriptores que los necesiten.
+type EventPoller struct {
+	repo     *repository.TaskRepository
+	bus      *events.Bus
+	interval time.Duration
+}
+
+func NewEventPoller(repo *repository.TaskRepository, bus *events.Bus, interval time.Duration) *EventPoller {
+	return &EventPoller{
+		repo:     repo,
+		bus:      bus,
+		interval: interval,
+	}
+}
+
+// Run consulta cada interval hasta que se cancele el contexto
+func (p *EventPoller) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	since := time.Now()
+	overlap := eventPollerOverlap
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if !p.bus.HasRemoteSubscribers() {
+			// Nadie escucha: al volver a haber suscriptores no se reenvía lo viejo
+			since = time.Now()
+			continue
+		}
+
+		found, err := p.repo.EventsSince(ctx, since.Add(-overlap), eventPollerBatch)
+		if err != nil {
+			log.Printf("❌ %v", err)
+			continue
+		}
+		for _, event := range found {
+			p.bus.PublishIfNew(event)
+			if event.At.After(since) {
+				since = event.At
+			}
+		}
+		// Con la tanda llena hay más por leer: sin margen, para no volver a
+		// leer siempre los mismos eventos
+		if len(found) == eventPollerBatch {
+			overlap = 0
+		} else {
+			overlap = eventPollerOverlap
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"log"
+	"taskProcessor/repository"
+	"time"
+)
+
+// ExpirySweeper pasa a expired las tareas pendientes cuyo expires_at venció.
+// ClaimTask ya no las entrega aunque el sweeper no haya pasado todavía; esto
+// solo deja el estado terminal a la vista (stats, historial, webhooks).
+type ExpirySweeper struct {
+	repo     *repository.TaskRepository
+	interval time.Duration
+}
+
+func NewExpirySweeper(repo *repository.TaskRepository, interval time.Duration) *ExpirySweeper {
+	return &ExpirySweeper{
+		repo:     repo,
+		interval: interval,
+	}
+}
+
+// Run revisa cada interval hasta que se cancele el contexto
+func (s *ExpirySweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		expired, err := s.repo.ExpirePending(ctx)
+		if err != nil {
+			log.Printf("❌ %v", err)
+		} else if expired > 0 {
+			log.Printf("⌛ %d tareas expiradas", expired)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
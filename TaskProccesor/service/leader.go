@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+	"taskProcessor/repository"
+	"time"
+)
+
+// LeaderElector decide qué proceso ejecuta los componentes que deben correr una
+// sola vez aunque haya varias réplicas (reaper, sweepers, dispatcher). Cada
+// componente tiene su propio lease, así el liderazgo puede repartirse.
+type LeaderElector struct {
+	leases *repository.LeaseRepository
+	owner  string
+	ttl    time.Duration
+	renew  time.Duration
+}
+
+// NewLeaderElector crea un elector que identifica a este proceso como owner.
+// El lease dura ttl y se renueva (o se intenta tomar) cada ttl/3.
+func NewLeaderElector(leases *repository.LeaseRepository, owner string, ttl time.Duration) *LeaderElector {
+	if ttl <= 0 {
+		ttl = 15 * time.Second
+	}
+	return &LeaderElector{
+		leases: leases,
+		owner:  owner,
+		ttl:    ttl,
+		renew:  ttl / 3,
+	}
+}
+
+// RunAsLeader ejecuta fn mientras este proceso tenga el lease name. Si pierde el
+// lease (otro proceso lo tomó o no pudo renovarlo antes de que venza) cancela el
+// contexto de fn y espera a que retorne; si lo recupera, la vuelve a lanzar.
+// Bloquea hasta que se cancele ctx y al salir libera el lease.
+func (e *LeaderElector) RunAsLeader(ctx context.Context, name string, fn func(ctx context.Context)) {
+	ticker := time.NewTicker(e.renew)
+	defer ticker.Stop()
+
+	var (
+		cancel  context.CancelFunc
+		done    sync.WaitGroup
+		expires time.Time // Hasta cuándo vale el último lease confirmado
+	)
+	stepDown := func() {
+		if cancel == nil {
+			return
+		}
+		cancel()
+		done.Wait()
+		cancel = nil
+	}
+
+	for {
+		now := time.Now()
+		acquired, err := e.leases.Acquire(ctx, name, e.owner, e.ttl)
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				break
+			}
+			log.Printf("❌ %v", err)
+			// Sin confirmar la renovación, se sigue siendo líder solo hasta que el
+			// lease anterior esté por vencer
+			if cancel != nil && time.Until(expires) < e.renew {
+				log.Printf("👋 %s: no se pudo renovar el liderazgo, se detiene", name)
+				stepDown()
+			}
+		case acquired:
+			expires = now.Add(e.ttl)
+			if cancel == nil {
+				log.Printf("👑 %s: este proceso es el líder", name)
+				var leaderCtx context.Context
+				leaderCtx, cancel = context.WithCancel(ctx)
+				done.Add(1)
+				go func() {
+					defer done.Done()
+					fn(leaderCtx)
+				}()
+			}
+		default:
+			if cancel != nil {
+				log.Printf("👋 %s: otro proceso tomó el liderazgo", name)
+				stepDown()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			wasLeader := cancel != nil
+			stepDown()
+			if wasLeader {
+				// ctx ya está cancelado: se libera con uno propio y corto
+				releaseCtx, cancelRelease := context.WithTimeout(context.Background(), 5*time.Second)
+				if err := e.leases.Release(releaseCtx, name, e.owner); err != nil {
+					log.Printf("❌ %v", err)
+				}
+				cancelRelease()
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Metrics contadores del worker pool, seguros para usar desde varias goroutines
+type Metrics struct {
+	processed atomic.Int64
+	failed    atomic.Int64
+	timeouts  atomic.Int64
+	panics    atomic.Int64
+
+	// Autoscaling (los valores medidos se actualizan en cada evaluación)
+	workers    atomic.Int64
+	scaleUps   atomic.Int64
+	scaleDowns atomic.Int64
+	readyTasks atomic.Int64
+	avgWait    atomic.Int64 // time.Duration
+	avgLatency atomic.Int64 // time.Duration
+}
+
+// MetricsSnapshot valores de las métricas en un momento dado
+type MetricsSnapshot struct {
+	TasksProcessed int64 `json:"tasks_processed"`
+	TasksFailed    int64 `json:"tasks_failed"`
+	TasksTimedOut  int64 `json:"tasks_timed_out"`
+	HandlerPanics  int64 `json:"handler_panics"`
+	Workers        int64 `json:"workers"`
+	ScaleUps       int64 `json:"scale_ups"`
+	ScaleDowns     int64 `json:"scale_downs"`
+	ReadyTasks     int64 `json:"ready_tasks"`
+	AvgClaimWaitMs int64 `json:"avg_claim_wait_ms"`
+	AvgHandlerMs   int64 `json:"avg_handler_ms"`
+}
+
+// Snapshot retorna una copia de los contadores actuales
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	return MetricsSnapshot{
+		TasksProcessed: m.processed.Load(),
+		TasksFailed:    m.failed.Load(),
+		TasksTimedOut:  m.timeouts.Load(),
+		HandlerPanics:  m.panics.Load(),
+		Workers:        m.workers.Load(),
+		ScaleUps:       m.scaleUps.Load(),
+		ScaleDowns:     m.scaleDowns.Load(),
+		ReadyTasks:     m.readyTasks.Load(),
+		AvgClaimWaitMs: time.Duration(m.avgWait.Load()).Milliseconds(),
+		AvgHandlerMs:   time.Duration(m.avgLatency.Load()).Milliseconds(),
+	}
+}
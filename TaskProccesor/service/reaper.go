@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"log"
+	"taskProcessor/repository"
+	"time"
+)
+
+// Reaper detecta pools de workers muertos y tareas con lease vencido
+// y las devuelve a la cola. También libera slots de concurrencia huérfanos y
+// termina de encolar tareas hijas interrumpidas.
+type Reaper struct {
+	repo       *repository.TaskRepository
+	workers    *repository.WorkerRepository
+	interval   time.Duration
+	staleAfter time.Duration
+}
+
+// NewReaper crea un reaper que revisa cada interval y da por muerto a un pool
+// sin heartbeat durante staleAfter
+func NewReaper(repo *repository.TaskRepository, workers *repository.WorkerRepository, interval, staleAfter time.Duration) *Reaper {
+	return &Reaper{
+		repo:       repo,
+		workers:    workers,
+		interval:   interval,
+		staleAfter: staleAfter,
+	}
+}
+
+// Run ejecuta el reaper hasta que se cancele el contexto
+func (r *Reaper) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.reap(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Reaper) reap(ctx context.Context) {
+	// 1. Pools muertos: se liberan sus tareas sin esperar a que venza el lease
+	dead, err := r.workers.RemoveStale(ctx, r.staleAfter)
+	if err != nil {
+		log.Printf("❌ Error al buscar workers muertos: %v", err)
+	}
+	for _, poolID := range dead {
+		released, err := r.repo.ReleaseWorkerClaims(ctx, poolID)
+		if err != nil {
+			log.Printf("❌ %v", err)
+			continue
+		}
+		log.Printf("💀 Pool %s sin heartbeat: %d tareas liberadas", poolID, released)
+	}
+
+	// 2. Leases vencidos (workers colgados o de procesos que no se registraron)
+	released, err := r.repo.ReleaseExpiredLeases(ctx)
+	if err != nil {
+		log.Printf("❌ %v", err)
+	} else if released > 0 {
+		log.Printf("⏰ %d tareas con lease vencido liberadas", released)
+	}
+
+	// 3. Slots de concurrencia de tareas que ya no están en ejecución
+	released, err = r.repo.ReleaseOrphanSlots(ctx)
+	if err != nil {
+		log.Printf("❌ %v", err)
+	} else if released > 0 {
+		log.Printf("🔓 %d claves de concurrencia con slots huérfanos liberadas", released)
+	}
+
+	// 4. Tareas hijas que quedaron sin insertar (solo sin transacciones)
+	flushed, err := r.repo.FlushPendingChildren(ctx)
+	if err != nil {
+		log.Printf("❌ %v", err)
+	} else if flushed > 0 {
+		log.Printf("🧒 %d tareas hijas pendientes encoladas", flushed)
+	}
+}
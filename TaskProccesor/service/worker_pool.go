@@ -0,0 +1,650 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"taskProcessor/events"
+	"taskProcessor/models"
+	"taskProcessor/repository"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Handler procesa una tarea de un tipo concreto.
+// Si retorna error, la tarea se marca como fallida y se reintenta según max_attempts,
+// salvo que el error sea permanente (ver Permanent).
+type Handler func(ctx context.Context, task *models.Task) (Result, error)
+
+// Result resultado de un handler exitoso
+type Result struct {
+	Output string
+	// Children tareas de continuación. Se encolan en la misma operación atómica
+	// que marca la tarea como procesada: no se pierden ni se duplican si el
+	// proceso muere en el medio.
+	Children []*models.Task
+}
+
+// HandlerOptions opciones de un tipo de tarea
+type HandlerOptions struct {
+	Timeout          time.Duration // Máximo por intento (0 = PoolConfig.DefaultTimeout)
+	BreakerThreshold int           // Fallos seguidos que abren el circuit breaker del tipo (0 = sin breaker)
+	BreakerCooldown  time.Duration // Tiempo con el breaker abierto antes de probar otra tarea
+	RetryBackoff     time.Duration // Espera antes del primer reintento; se duplica en cada intento (0 = inmediato)
+	MaxRetryBackoff  time.Duration // Tope de la espera entre reintentos (0 = 10 minutos)
+}
+
+// ErrTimeout se usa cuando un handler supera su tiempo máximo de ejecución
+var ErrTimeout = errors.New("timeout de ejecución")
+
+// PermanentError error de un handler que no tiene sentido reintentar
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent marca un error como no reintentable: la tarea pasa directo a dead
+// sin gastar los intentos que le quedan (por ejemplo, un payload inválido)
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// PanicError error de un handler que entró en panic
+type PanicError struct {
+	Value interface{}
+	Stack string
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// registeredHandler handler junto con sus opciones
+type registeredHandler struct {
+	handler Handler
+	options HandlerOptions
+}
+
+// handlerOutcome lo que retornó un handler ejecutado en su propia goroutine
+type handlerOutcome struct {
+	result Result
+	err    error
+}
+
+// PoolConfig configuración del worker pool
+type PoolConfig struct {
+	WorkerCount       int           // Cantidad de goroutines que procesan tareas (con autoscaling, la inicial)
+	MinWorkers        int           // Con MaxWorkers > 0 el pool escala entre MinWorkers y MaxWorkers
+	MaxWorkers        int           // 0 = tamaño fijo (WorkerCount)
+	ScaleInterval     time.Duration // Cada cuánto se evalúa el tamaño del pool
+	ScaleUpCooldown   time.Duration // Espera mínima entre dos escalados hacia arriba
+	ScaleDownCooldown time.Duration // Espera mínima desde el último escalado antes de achicar
+	TargetWait        time.Duration // Espera aceptable de una tarea lista hasta que un worker la toma
+	Queues            []string      // Colas que atiende el pool (vacío = todas)
+	Tags              []string      // Capacidades del host: el pool solo toma tareas cuyas required_tags estén todas acá
+	PollInterval      time.Duration // Primera espera cuando no hay tareas; se duplica en cada intento vacío
+	MaxPollInterval   time.Duration // Tope de la espera entre intentos vacíos
+	ChangeStreams     bool          // Despertar a los workers con un change stream (requiere replica set)
+	HeartbeatInterval time.Duration // Cada cuánto se registra el heartbeat y se extienden leases
+	LeaseDuration     time.Duration // Lease de cada tarea reclamada
+	DefaultTimeout    time.Duration // Máximo por intento si ni el tipo ni la tarea lo definen (0 = sin límite)
+}
+
+// WorkerPool grupo de goroutines que reclaman y procesan tareas
+type WorkerPool struct {
+	id       string
+	config   PoolConfig
+	repo     *repository.TaskRepository
+	workers  *repository.WorkerRepository
+	breakers *repository.BreakerRepository
+	handlers map[string]registeredHandler
+	metrics  Metrics
+	bus      *events.Bus
+
+	mu         sync.Mutex
+	running    map[primitive.ObjectID]models.RunningTask
+	wake       chan struct{}   // Se cierra (y se reemplaza) para despertar a los workers inactivos
+	stops      []chan struct{} // Uno por worker vivo: cerrarlo lo detiene después de su tarea actual
+	nextWorker int             // Número del próximo worker (los IDs no se reutilizan)
+	window     scaleWindow     // Mediciones para el autoscaling
+
+	ctx    context.Context // Contexto de los workers (para lanzar nuevos al escalar)
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewWorkerPool(repo *repository.TaskRepository, workers *repository.WorkerRepository, breakers *repository.BreakerRepository, config PoolConfig) *WorkerPool {
+	if config.WorkerCount <= 0 {
+		config.WorkerCount = 1
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = time.Second
+	}
+	if config.MaxPollInterval < config.PollInterval {
+		config.MaxPollInterval = max(10*time.Second, config.PollInterval)
+	}
+	if config.HeartbeatInterval <= 0 {
+		config.HeartbeatInterval = 10 * time.Second
+	}
+	if config.LeaseDuration <= 0 {
+		config.LeaseDuration = repository.DefaultLeaseDuration
+	}
+	if config.MaxWorkers > 0 {
+		config.MinWorkers = max(1, config.MinWorkers)
+		config.MaxWorkers = max(config.MaxWorkers, config.MinWorkers)
+		config.WorkerCount = min(max(config.WorkerCount, config.MinWorkers), config.MaxWorkers)
+		if config.ScaleInterval <= 0 {
+			config.ScaleInterval = 10 * time.Second
+		}
+		if config.ScaleUpCooldown <= 0 {
+			config.ScaleUpCooldown = 30 * time.Second
+		}
+		if config.ScaleDownCooldown <= 0 {
+			config.ScaleDownCooldown = 2 * time.Minute
+		}
+		if config.TargetWait <= 0 {
+			config.TargetWait = 5 * time.Second
+		}
+	}
+
+	hostname, _ := os.Hostname()
+
+	return &WorkerPool{
+		id:       fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), primitive.NewObjectID().Hex()[18:]),
+		config:   config,
+		repo:     repo,
+		workers:  workers,
+		breakers: breakers,
+		handlers: map[string]registeredHandler{},
+		running:  map[primitive.ObjectID]models.RunningTask{},
+		wake:     make(chan struct{}),
+	}
+}
+
+// ID identificador del pool en el registro de workers
+func (p *WorkerPool) ID() string {
+	return p.id
+}
+
+// Metrics métricas del pool
+func (p *WorkerPool) Metrics() *Metrics {
+	return &p.metrics
+}
+
+// SetEventBus publica en bus cuándo empieza cada ejecución y despierta a los
+// workers inactivos cuando este proceso encola una tarea. Debe llamarse antes de Start.
+func (p *WorkerPool) SetEventBus(bus *events.Bus) {
+	p.bus = bus
+}
+
+// Register asocia un handler a un tipo de tarea. Debe llamarse antes de Start.
+func (p *WorkerPool) Register(taskType string, handler Handler) {
+	p.RegisterWithOptions(taskType, handler, HandlerOptions{})
+}
+
+// RegisterWithOptions igual que Register, con opciones para el tipo (por ejemplo, timeout)
+func (p *WorkerPool) RegisterWithOptions(taskType string, handler Handler, options HandlerOptions) {
+	if options.BreakerThreshold > 0 && options.BreakerCooldown <= 0 {
+		options.BreakerCooldown = time.Minute
+	}
+	p.handlers[taskType] = registeredHandler{handler: handler, options: options}
+}
+
+// Start registra el pool y lanza los workers y el heartbeat
+func (p *WorkerPool) Start(ctx context.Context) error {
+	hostname, _ := os.Hostname()
+	worker := &models.Worker{
+		ID:          p.id,
+		Hostname:    hostname,
+		PID:         os.Getpid(),
+		Concurrency: p.config.WorkerCount,
+		Queues:      p.config.Queues,
+		Tags:        p.config.Tags,
+	}
+	if err := p.workers.Register(ctx, worker); err != nil {
+		return err
+	}
+
+	ctx, p.cancel = context.WithCancel(ctx)
+	p.ctx = ctx
+
+	for i := 0; i < p.config.WorkerCount; i++ {
+		p.startWorker()
+	}
+
+	p.wg.Add(1)
+	go p.runHeartbeat(ctx, worker)
+
+	if p.autoscaling() {
+		p.wg.Add(1)
+		go p.runAutoscaler(ctx)
+	}
+
+	if p.bus != nil {
+		p.wg.Add(1)
+		go p.runWakeOnEnqueue(ctx)
+	}
+	if p.config.ChangeStreams {
+		p.wg.Add(1)
+		go p.runChangeStream(ctx)
+	}
+
+	if p.autoscaling() {
+		log.Printf("👷 Worker pool %s iniciado con %d workers (autoscaling %d-%d)", p.id, p.config.WorkerCount, p.config.MinWorkers, p.config.MaxWorkers)
+	} else {
+		log.Printf("👷 Worker pool %s iniciado con %d workers", p.id, p.config.WorkerCount)
+	}
+	return nil
+}
+
+// Stop detiene los workers, espera a que terminen y elimina el registro del pool
+func (p *WorkerPool) Stop() {
+	if p.cancel == nil {
+		return
+	}
+	p.cancel()
+	p.wg.Wait()
+
+	if err := p.workers.Deregister(context.Background(), p.id); err != nil {
+		log.Printf("❌ Error al eliminar el registro del pool: %v", err)
+	}
+	log.Printf("👷 Worker pool %s detenido", p.id)
+}
+
+// claimOptions restricciones de reclamo del pool: sus colas y tags, y solo los
+// tipos con handler registrado (los demás son de otros pools)
+func (p *WorkerPool) claimOptions() repository.ClaimOptions {
+	types := make([]string, 0, len(p.handlers))
+	for taskType := range p.handlers {
+		types = append(types, taskType)
+	}
+	sort.Strings(types)
+	return repository.ClaimOptions{
+		Queues:        p.config.Queues,
+		Types:         types,
+		Tags:          p.config.Tags,
+		LeaseDuration: p.config.LeaseDuration,
+	}
+}
+
+// runWorker bucle de un worker: reclamar, procesar, repetir. Termina cuando se
+// cancela el contexto o, sin interrumpir una tarea en curso, cuando se cierra stop.
+func (p *WorkerPool) runWorker(ctx context.Context, workerID string, stop <-chan struct{}) {
+	defer p.wg.Done()
+
+	claimOpts := p.claimOptions()
+
+	// Sin tareas la espera crece de PollInterval a MaxPollInterval, así una cola
+	// vacía no recibe una consulta tras otra; Wake la corta
+	delay := p.config.PollInterval
+	for ctx.Err() == nil {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		// Se toma antes de reclamar: un Wake entre el intento vacío y la espera no se pierde
+		wake := p.wakeChannel()
+
+		task, err := p.repo.ClaimTaskWithOptions(ctx, workerID, claimOpts)
+		if err != nil {
+			log.Printf("❌ [%s] Error al reclamar tarea: %v", workerID, err)
+		}
+		if task == nil {
+			waitForWork(ctx, wake, stop, jitter(delay))
+			delay = min(2*delay, p.config.MaxPollInterval)
+			continue
+		}
+
+		delay = p.config.PollInterval
+		p.observeWait(task)
+		p.process(ctx, workerID, task)
+	}
+}
+
+// Wake despierta a los workers que esperan porque no había tareas
+func (p *WorkerPool) Wake() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	close(p.wake)
+	p.wake = make(chan struct{})
+}
+
+func (p *WorkerPool) wakeChannel() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.wake
+}
+
+// runWakeOnEnqueue despierta a los workers cuando este proceso deja una tarea pending
+func (p *WorkerPool) runWakeOnEnqueue(ctx context.Context) {
+	defer p.wg.Done()
+
+	subscription := p.bus.SubscribeLocal(events.Filter{}, 64)
+	defer subscription.Unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-subscription.C:
+			if !ok {
+				return
+			}
+			if event.Status == models.StatusPending {
+				p.Wake()
+			}
+		}
+	}
+}
+
+// runChangeStream despierta a los workers cuando cualquier proceso deja una tarea
+// pending. Sin replica set se queda solo con el polling.
+func (p *WorkerPool) runChangeStream(ctx context.Context) {
+	defer p.wg.Done()
+
+	for ctx.Err() == nil {
+		err := p.repo.WatchPending(ctx, p.Wake)
+		if errors.Is(err, repository.ErrChangeStreamsUnsupported) {
+			log.Printf("⚠️  %v: los workers solo hacen polling", err)
+			return
+		}
+		if err != nil {
+			log.Printf("❌ %v", err)
+			sleep(ctx, 5*time.Second)
+		}
+	}
+}
+
+// process ejecuta el handler de la tarea y registra el resultado
+func (p *WorkerPool) process(ctx context.Context, workerID string, task *models.Task) {
+	p.trackStart(workerID, task)
+	defer p.trackEnd(task.ID)
+
+	// El resultado se guarda aunque el pool se esté deteniendo
+	writeCtx := context.WithoutCancel(ctx)
+
+	registered, ok := p.handlers[task.Type]
+	if !ok {
+		errMsg := fmt.Sprintf("no hay handler para el tipo %q", task.Type)
+		if err := p.repo.MarkAsFailed(writeCtx, task.ID, workerID, errMsg, false); err != nil {
+			log.Printf("❌ [%s] Error al marcar tarea %s como fallida: %v", workerID, task.ID.Hex(), err)
+		}
+		return
+	}
+
+	p.publishStarted(workerID, task)
+	start := time.Now()
+	result, err := p.runHandler(withCheckpointer(ctx, p.repo, task.ID, workerID), registered, task)
+	p.observeLatency(time.Since(start))
+	p.recordBreaker(writeCtx, registered.options, task.Type, err)
+	if err != nil {
+		p.metrics.failed.Add(1)
+		if errors.Is(err, ErrTimeout) {
+			p.metrics.timeouts.Add(1)
+		}
+
+		var stack string
+		var panicErr *PanicError
+		if errors.As(err, &panicErr) {
+			p.metrics.panics.Add(1)
+			stack = panicErr.Stack
+			log.Printf("💥 [%s] Panic en la tarea %s: %v\n%s", workerID, task.ID.Hex(), panicErr.Value, stack)
+		} else {
+			log.Printf("⚠️  [%s] Tarea %s falló (intento %d/%d): %v", workerID, task.ID.Hex(), task.Attempts, task.MaxAttempts, err)
+		}
+
+		var permanentErr *PermanentError
+		retryable := !errors.As(err, &permanentErr)
+		failure := repository.Failure{
+			Message:    err.Error(),
+			Stack:      stack,
+			Retryable:  retryable,
+			RetryDelay: retryDelay(registered.options, task.Attempts),
+		}
+		if err := p.repo.RecordFailure(writeCtx, task.ID, workerID, failure); err != nil {
+			log.Printf("❌ [%s] Error al marcar tarea %s como fallida: %v", workerID, task.ID.Hex(), err)
+		}
+		return
+	}
+
+	if len(result.Children) > 0 {
+		err = p.repo.CompleteWithChildren(writeCtx, task.ID, workerID, result.Output, result.Children)
+	} else {
+		err = p.repo.MarkAsProcessed(writeCtx, task.ID, workerID, result.Output)
+	}
+	if err != nil {
+		log.Printf("❌ [%s] Error al marcar tarea %s como procesada: %v", workerID, task.ID.Hex(), err)
+		return
+	}
+	p.metrics.processed.Add(1)
+	if len(result.Children) > 0 {
+		log.Printf("✅ [%s] Tarea procesada: %s (%d tareas hijas encoladas)", workerID, task.Title, len(result.Children))
+	} else {
+		log.Printf("✅ [%s] Tarea procesada: %s", workerID, task.Title)
+	}
+}
+
+// publishStarted avisa al bus que la tarea empezó a ejecutarse
+func (p *WorkerPool) publishStarted(workerID string, task *models.Task) {
+	if p.bus == nil {
+		return
+	}
+	p.bus.Publish(events.Event{
+		TaskID:   task.ID.Hex(),
+		TaskType: task.Type,
+		Queue:    task.Queue,
+		TaskEvent: models.TaskEvent{
+			Type:     events.TypeStarted,
+			At:       time.Now(),
+			WorkerID: workerID,
+			Attempt:  task.Attempts,
+			Status:   models.StatusRunning,
+		},
+	})
+}
+
+// runHandler ejecuta el handler con el timeout que corresponda a la tarea.
+// El handler corre en su propia goroutine: si no respeta la cancelación del
+// contexto, el worker igual se libera al vencer el plazo.
+func (p *WorkerPool) runHandler(ctx context.Context, registered registeredHandler, task *models.Task) (Result, error) {
+	timeout := p.timeoutFor(registered, task)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	done := make(chan handlerOutcome, 1)
+	go func() {
+		// Un panic en el handler no debe tumbar el proceso: se convierte en un
+		// error con el stack trace y el worker sigue vivo
+		defer func() {
+			if value := recover(); value != nil {
+				done <- handlerOutcome{err: &PanicError{Value: value, Stack: string(debug.Stack())}}
+			}
+		}()
+
+		result, err := registered.handler(ctx, task)
+		done <- handlerOutcome{result: result, err: err}
+	}()
+
+	select {
+	case outcome := <-done:
+		if outcome.err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return Result{}, fmt.Errorf("%w: la tarea superó %s (%v)", ErrTimeout, timeout, outcome.err)
+		}
+		return outcome.result, outcome.err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return Result{}, fmt.Errorf("%w: la tarea superó %s", ErrTimeout, timeout)
+		}
+		// El pool se está deteniendo: esperar a que el handler termine
+		outcome := <-done
+		return outcome.result, outcome.err
+	}
+}
+
+// retryDelay espera antes de reintentar una tarea que falló en su intento número
+// attempt: RetryBackoff, 2×RetryBackoff, 4×RetryBackoff... hasta MaxRetryBackoff
+func retryDelay(options HandlerOptions, attempt int) time.Duration {
+	if options.RetryBackoff <= 0 {
+		return 0
+	}
+	maxDelay := options.MaxRetryBackoff
+	if maxDelay <= 0 {
+		maxDelay = 10 * time.Minute
+	}
+
+	delay := options.RetryBackoff
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
+
+// recordBreaker actualiza el circuit breaker del tipo con el resultado del intento.
+// Los errores permanentes (payload inválido) y la pérdida de la tarea
+// (ErrTaskNotOwned) no dicen nada de la salud del servicio que usa el handler:
+// no cuentan ni como éxito ni como fallo. Un probe que termina así se libera
+// solo cuando vence su timeout.
+func (p *WorkerPool) recordBreaker(ctx context.Context, options HandlerOptions, taskType string, handlerErr error) {
+	if options.BreakerThreshold <= 0 || p.breakers == nil {
+		return
+	}
+	var permanentErr *PermanentError
+	if errors.As(handlerErr, &permanentErr) || errors.Is(handlerErr, repository.ErrTaskNotOwned) {
+		return
+	}
+
+	var err error
+	if handlerErr == nil {
+		err = p.breakers.RecordSuccess(ctx, taskType)
+	} else {
+		err = p.breakers.RecordFailure(ctx, taskType, options.BreakerThreshold, options.BreakerCooldown)
+	}
+	if err != nil {
+		log.Printf("❌ %v", err)
+	}
+}
+
+// timeoutFor timeout de un intento: el de la tarea, si no el del tipo, si no el del pool
+func (p *WorkerPool) timeoutFor(registered registeredHandler, task *models.Task) time.Duration {
+	if task.TimeoutSeconds > 0 {
+		return time.Duration(task.TimeoutSeconds) * time.Second
+	}
+	if registered.options.Timeout > 0 {
+		return registered.options.Timeout
+	}
+	return p.config.DefaultTimeout
+}
+
+// runHeartbeat registra periódicamente que el pool sigue vivo y extiende
+// los leases de las tareas en curso
+func (p *WorkerPool) runHeartbeat(ctx context.Context, worker *models.Worker) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.config.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		running := p.runningTasks()
+		registered, err := p.workers.Heartbeat(ctx, p.id, p.workerCount(), running)
+		if err != nil {
+			log.Printf("❌ Error en heartbeat del pool %s: %v", p.id, err)
+			continue
+		}
+		if !registered {
+			// El reaper nos dio por muertos (por ejemplo, tras una pausa larga): volver a registrarse
+			log.Printf("⚠️  Pool %s no estaba registrado, registrando de nuevo", p.id)
+			worker.Concurrency = p.workerCount()
+			if err := p.workers.Register(ctx, worker); err != nil {
+				log.Printf("❌ Error al re-registrar el pool %s: %v", p.id, err)
+			}
+		}
+
+		for _, task := range running {
+			if err := p.repo.ExtendLease(ctx, task.TaskID, task.WorkerID, p.config.LeaseDuration); err != nil {
+				log.Printf("⚠️  No se pudo extender el lease de la tarea %s: %v", task.TaskID.Hex(), err)
+			}
+		}
+	}
+}
+
+func (p *WorkerPool) trackStart(workerID string, task *models.Task) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running[task.ID] = models.RunningTask{
+		WorkerID:  workerID,
+		TaskID:    task.ID,
+		Type:      task.Type,
+		StartedAt: time.Now(),
+	}
+}
+
+func (p *WorkerPool) trackEnd(taskID primitive.ObjectID) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.running, taskID)
+}
+
+func (p *WorkerPool) runningTasks() []models.RunningTask {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	running := make([]models.RunningTask, 0, len(p.running))
+	for _, task := range p.running {
+		running = append(running, task)
+	}
+	return running
+}
+
+// waitForWork espera d, hasta que se despierte a los workers, se detenga este
+// worker o se cancele el contexto
+func waitForWork(ctx context.Context, wake, stop <-chan struct{}, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-wake:
+	case <-stop:
+	case <-timer.C:
+	}
+}
+
+// jitter espera al azar entre d/2 y d, para que los workers no consulten a la vez
+func jitter(d time.Duration) time.Duration {
+	return d/2 + rand.N(d/2+1)
+}
+
+// sleep espera d o hasta que se cancele el contexto
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
@@ -0,0 +1,160 @@
+package transport
+
+import (
+	"embed"
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"taskProcessor/models"
+	"taskProcessor/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//go:embed templates/*.html
+var templateFiles embed.FS
+
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	"json": func(value interface{}) string {
+		data, _ := json.MarshalIndent(value, "", "  ")
+		return string(data)
+	},
+	"join": strings.Join,
+}).ParseFS(templateFiles, "templates/*.html"))
+
+// DashboardHandler sirve el dashboard HTML de la cola de tareas
+type DashboardHandler struct {
+	repo   *repository.TaskRepository
+	pauses *repository.PauseRepository
+}
+
+func NewDashboardHandler(repo *repository.TaskRepository, pauses *repository.PauseRepository) *DashboardHandler {
+	return &DashboardHandler{
+		repo:   repo,
+		pauses: pauses,
+	}
+}
+
+// dashboardData datos que recibe templates/dashboard.html
+type dashboardData struct {
+	Statuses []string
+	Stats    *models.TaskStats
+	Failures []*models.Task
+	Workers  []*models.WorkerActivity
+	Recent   []*models.Task
+}
+
+// HandleDashboard GET /dashboard
+func (handler *DashboardHandler) HandleDashboard(writer http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	stats, err := handler.repo.Stats(ctx)
+	if err != nil {
+		http.Error(writer, "Error al obtener estadísticas", http.StatusInternalServerError)
+		return
+	}
+	failures, err := handler.repo.FindRecentFailures(ctx, 10)
+	if err != nil {
+		http.Error(writer, "Error al obtener fallos recientes", http.StatusInternalServerError)
+		return
+	}
+	workers, err := handler.repo.WorkerActivity(ctx)
+	if err != nil {
+		http.Error(writer, "Error al obtener actividad de workers", http.StatusInternalServerError)
+		return
+	}
+	recent, err := handler.repo.FindAll(ctx, 20)
+	if err != nil {
+		http.Error(writer, "Error al obtener tareas", http.StatusInternalServerError)
+		return
+	}
+
+	render(writer, "dashboard.html", dashboardData{
+		Statuses: models.Statuses,
+		Stats:    stats,
+		Failures: failures,
+		Workers:  workers,
+		Recent:   recent,
+	})
+}
+
+// HandleTaskDetail GET /dashboard/tasks/{id}
+func (handler *DashboardHandler) HandleTaskDetail(writer http.ResponseWriter, request *http.Request) {
+	id, err := primitive.ObjectIDFromHex(request.PathValue("id"))
+	if err != nil {
+		http.Error(writer, "ID de tarea inválido", http.StatusBadRequest)
+		return
+	}
+
+	task, err := handler.repo.GetByID(request.Context(), id)
+	if err != nil {
+		http.Error(writer, "Error al obtener la tarea", http.StatusInternalServerError)
+		return
+	}
+	if task == nil {
+		http.Error(writer, "Tarea no encontrada", http.StatusNotFound)
+		return
+	}
+
+	render(writer, "task.html", task)
+}
+
+// HandleTaskAction POST /dashboard/tasks/{id}/{action}
+// Ejecuta retry o cancel desde los botones del detalle y vuelve a la página.
+func (handler *DashboardHandler) HandleTaskAction(writer http.ResponseWriter, request *http.Request) {
+	id, err := primitive.ObjectIDFromHex(request.PathValue("id"))
+	if err != nil {
+		http.Error(writer, "ID de tarea inválido", http.StatusBadRequest)
+		return
+	}
+
+	switch request.PathValue("action") {
+	case "retry":
+		err = handler.repo.Retry(request.Context(), id)
+	case "cancel":
+		err = handler.repo.Cancel(request.Context(), id)
+	default:
+		http.Error(writer, "Acción desconocida", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeRepositoryError(writer, err)
+		return
+	}
+
+	http.Redirect(writer, request, "/dashboard/tasks/"+id.Hex(), http.StatusSeeOther)
+}
+
+// HandlePauseAction POST /dashboard/pauses/{action}
+// Pausa o reanuda una cola/tipo desde el formulario del dashboard.
+func (handler *DashboardHandler) HandlePauseAction(writer http.ResponseWriter, request *http.Request) {
+	kind := request.FormValue("kind")
+	name := request.FormValue("name")
+
+	var err error
+	switch request.PathValue("action") {
+	case "pause":
+		err = handler.pauses.Pause(request.Context(), kind, name, request.FormValue("reason"))
+	case "resume":
+		_, err = handler.pauses.Resume(request.Context(), kind, name)
+	default:
+		http.Error(writer, "Acción desconocida", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(writer, request, "/dashboard", http.StatusSeeOther)
+}
+
+// render ejecuta un template y responde con HTML
+func render(writer http.ResponseWriter, name string, data interface{}) {
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := templates.ExecuteTemplate(writer, name, data); err != nil {
+		log.Printf("❌ Error al renderizar %s: %v", name, err)
+	}
+}
@@ -0,0 +1,22 @@
+package transport
+
+import (
+	"net/http"
+	"taskProcessor/service"
+)
+
+// MetricsHandler expone las métricas del worker pool
+type MetricsHandler struct {
+	metrics *service.Metrics
+}
+
+func NewMetricsHandler(metrics *service.Metrics) *MetricsHandler {
+	return &MetricsHandler{
+		metrics: metrics,
+	}
+}
+
+// HandleMetrics GET /metrics
+func (handler *MetricsHandler) HandleMetrics(writer http.ResponseWriter, request *http.Request) {
+	writeJSON(writer, http.StatusOK, handler.metrics.Snapshot())
+}
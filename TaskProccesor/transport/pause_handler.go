@@ -0,0 +1,73 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"taskProcessor/repository"
+)
+
+// PauseHandler endpoints para pausar y reanudar colas o tipos de tarea
+type PauseHandler struct {
+	repo *repository.PauseRepository
+}
+
+func NewPauseHandler(repo *repository.PauseRepository) *PauseHandler {
+	return &PauseHandler{
+		repo: repo,
+	}
+}
+
+// pauseRequest cuerpo de POST /pauses
+type pauseRequest struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// HandleListPauses GET /pauses
+func (handler *PauseHandler) HandleListPauses(writer http.ResponseWriter, request *http.Request) {
+	pauses, err := handler.repo.List(request.Context())
+	if err != nil {
+		http.Error(writer, "Error al obtener las pausas", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(writer, http.StatusOK, pauses)
+}
+
+// HandlePause POST /pauses
+func (handler *PauseHandler) HandlePause(writer http.ResponseWriter, request *http.Request) {
+	var body pauseRequest
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+		http.Error(writer, "Error al decodificar la pausa", http.StatusBadRequest)
+		return
+	}
+	if body.Name == "" {
+		http.Error(writer, "El nombre de la cola o tipo es obligatorio", http.StatusBadRequest)
+		return
+	}
+
+	if err := handler.repo.Pause(request.Context(), body.Kind, body.Name, body.Reason); err != nil {
+		if errors.Is(err, repository.ErrInvalidPauseKind) {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(writer, "Error al pausar", http.StatusInternalServerError)
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// HandleResume DELETE /pauses/{kind}/{name}
+func (handler *PauseHandler) HandleResume(writer http.ResponseWriter, request *http.Request) {
+	resumed, err := handler.repo.Resume(request.Context(), request.PathValue("kind"), request.PathValue("name"))
+	if err != nil {
+		http.Error(writer, "Error al reanudar", http.StatusInternalServerError)
+		return
+	}
+	if !resumed {
+		http.Error(writer, "No estaba pausado", http.StatusNotFound)
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,85 @@
+package transport
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"taskProcessor/events"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// streamBuffer eventos que se acumulan por cliente antes de descartar
+const streamBuffer = 256
+
+// streamKeepAlive cada cuánto se envía un comentario para que proxies y
+// navegadores no cierren la conexión inactiva
+const streamKeepAlive = 15 * time.Second
+
+// StreamHandler endpoint de eventos en vivo
+type StreamHandler struct {
+	bus *events.Bus
+}
+
+func NewStreamHandler(bus *events.Bus) *StreamHandler {
+	return &StreamHandler{
+		bus: bus,
+	}
+}
+
+// HandleStream GET /tasks/stream?id=...&type=...&queue=...
+// Server-Sent Events con cada transición de las tareas que cumplen el filtro.
+// El nombre del evento SSE es el tipo de transición (claimed, failed, progress...).
+func (handler *StreamHandler) HandleStream(writer http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+	filter := events.Filter{
+		TaskID: query.Get("id"),
+		Type:   query.Get("type"),
+		Queue:  query.Get("queue"),
+	}
+	if filter.TaskID != "" && !primitive.IsValidObjectID(filter.TaskID) {
+		http.Error(writer, "ID de tarea inválido", http.StatusBadRequest)
+		return
+	}
+
+	controller := http.NewResponseController(writer)
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.Header().Set("X-Accel-Buffering", "no")
+	writer.WriteHeader(http.StatusOK)
+	if err := controller.Flush(); err != nil {
+		return
+	}
+
+	subscription := handler.bus.Subscribe(filter, streamBuffer)
+	defer subscription.Unsubscribe()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(writer, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-subscription.C:
+			if !ok {
+				return // Se cerró el bus: el servidor se está apagando
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(writer, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return
+			}
+		}
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"taskProcessor/models"
+	"taskProcessor/repository"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type TaskHandler struct {
+	repo *repository.TaskRepository
+}
+
+func NewTaskHandler(repo *repository.TaskRepository) *TaskHandler {
+	return &TaskHandler{
+		repo: repo,
+	}
+}
+
+// queueFullRetryAfter segundos que se sugiere esperar (Retry-After) cuando la cola está llena
+const queueFullRetryAfter = "5"
+
+// HandleCreateTask POST /tasks
+// Responde 201 con la tarea creada, o 429 con Retry-After si su cola o tipo
+// llegó al máximo de tareas pendientes.
+func (handler *TaskHandler) HandleCreateTask(writer http.ResponseWriter, request *http.Request) {
+	var body models.TaskRequest
+	if err := json.NewDecoder(http.MaxBytesReader(writer, request.Body, 1<<20)).Decode(&body); err != nil {
+		http.Error(writer, "Error al decodificar la tarea", http.StatusBadRequest)
+		return
+	}
+	task, err := body.NewTask()
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := handler.repo.Create(request.Context(), task); err != nil {
+		writeRepositoryError(writer, err)
+		return
+	}
+	writeJSON(writer, http.StatusCreated, task)
+}
+
+// HandleSearchTasks GET /tasks
+// Filtros: status, type y queue (separados por coma o repetidos), worker,
+// created_after/created_before y processed_after/processed_before (RFC 3339),
+// min_attempts/max_attempts, title (contiene) y payload.<campo>=valor.
+// Orden: sort=campo o sort=-campo (descendente). Página: limit y cursor (el
+// next_cursor de la respuesta anterior).
+func (handler *TaskHandler) HandleSearchTasks(writer http.ResponseWriter, request *http.Request) {
+	query, err := parseTaskQuery(request.URL.Query())
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := handler.repo.Search(request.Context(), query)
+	if err != nil {
+		writeRepositoryError(writer, err)
+		return
+	}
+	writeJSON(writer, http.StatusOK, page)
+}
+
+// parseTaskQuery traduce los parámetros de GET /tasks a una búsqueda del repositorio
+func parseTaskQuery(values url.Values) (repository.TaskQuery, error) {
+	query := repository.TaskQuery{
+		Statuses:      listParam(values, "status"),
+		Types:         listParam(values, "type"),
+		Queues:        listParam(values, "queue"),
+		WorkerID:      values.Get("worker"),
+		TitleContains: values.Get("title"),
+		Cursor:        values.Get("cursor"),
+	}
+
+	times := map[string]**time.Time{
+		"created_after":    &query.CreatedAfter,
+		"created_before":   &query.CreatedBefore,
+		"processed_after":  &query.ProcessedAfter,
+		"processed_before": &query.ProcessedBefore,
+	}
+	for name, target := range times {
+		if value := values.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return query, fmt.Errorf("%s inválido (usar RFC 3339): %s", name, value)
+			}
+			*target = &parsed
+		}
+	}
+
+	ints := map[string]**int{
+		"min_attempts": &query.MinAttempts,
+		"max_attempts": &query.MaxAttempts,
+	}
+	for name, target := range ints {
+		if value := values.Get(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				return query, fmt.Errorf("%s inválido: %s", name, value)
+			}
+			*target = &parsed
+		}
+	}
+
+	if value := values.Get("limit"); value != "" {
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || limit <= 0 {
+			return query, fmt.Errorf("limit inválido: %s", value)
+		}
+		query.Limit = limit
+	}
+	if sort := values.Get("sort"); sort != "" {
+		query.SortBy, query.Descending = strings.CutPrefix(sort, "-")
+	}
+
+	for name := range values {
+		if field, ok := strings.CutPrefix(name, "payload."); ok {
+			if query.Payload == nil {
+				query.Payload = map[string]string{}
+			}
+			query.Payload[field] = values.Get(name)
+		}
+	}
+	return query, nil
+}
+
+// listParam valores de un parámetro que puede repetirse o ir separado por comas
+func listParam(values url.Values, name string) []string {
+	var list []string
+	for _, value := range values[name] {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+// HandleGetTask GET /tasks/{id}
+// Incluye el progreso reportado por el handler, así una UI puede hacer polling.
+func (handler *TaskHandler) HandleGetTask(writer http.ResponseWriter, request *http.Request) {
+	id, err := primitive.ObjectIDFromHex(request.PathValue("id"))
+	if err != nil {
+		http.Error(writer, "ID de tarea inválido", http.StatusBadRequest)
+		return
+	}
+
+	task, err := handler.repo.GetByID(request.Context(), id)
+	if err != nil {
+		http.Error(writer, "Error al obtener la tarea", http.StatusInternalServerError)
+		return
+	}
+	if task == nil {
+		http.Error(writer, "Tarea no encontrada", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(writer, http.StatusOK, task)
+}
+
+// HandleTaskEvents GET /tasks/{id}/events
+func (handler *TaskHandler) HandleTaskEvents(writer http.ResponseWriter, request *http.Request) {
+	id, err := primitive.ObjectIDFromHex(request.PathValue("id"))
+	if err != nil {
+		http.Error(writer, "ID de tarea inválido", http.StatusBadRequest)
+		return
+	}
+
+	events, err := handler.repo.Events(request.Context(), id)
+	if err != nil {
+		writeRepositoryError(writer, err)
+		return
+	}
+	writeJSON(writer, http.StatusOK, events)
+}
+
+// HandleRetryTask POST /tasks/{id}/retry
+func (handler *TaskHandler) HandleRetryTask(writer http.ResponseWriter, request *http.Request) {
+	id, err := primitive.ObjectIDFromHex(request.PathValue("id"))
+	if err != nil {
+		http.Error(writer, "ID de tarea inválido", http.StatusBadRequest)
+		return
+	}
+	if err := handler.repo.Retry(request.Context(), id); err != nil {
+		writeRepositoryError(writer, err)
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// HandleCancelTask POST /tasks/{id}/cancel
+func (handler *TaskHandler) HandleCancelTask(writer http.ResponseWriter, request *http.Request) {
+	id, err := primitive.ObjectIDFromHex(request.PathValue("id"))
+	if err != nil {
+		http.Error(writer, "ID de tarea inválido", http.StatusBadRequest)
+		return
+	}
+	if err := handler.repo.Cancel(request.Context(), id); err != nil {
+		writeRepositoryError(writer, err)
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// HandleStats GET /stats
+func (handler *TaskHandler) HandleStats(writer http.ResponseWriter, request *http.Request) {
+	stats, err := handler.repo.Stats(request.Context())
+	if err != nil {
+		http.Error(writer, "Error al obtener estadísticas", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(writer, http.StatusOK, stats)
+}
+
+// writeRepositoryError traduce los errores del repositorio a status HTTP
+func writeRepositoryError(writer http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repository.ErrTaskNotFound):
+		http.Error(writer, "Tarea no encontrada", http.StatusNotFound)
+	case errors.Is(err, repository.ErrInvalidState):
+		http.Error(writer, err.Error(), http.StatusConflict)
+	case errors.Is(err, repository.ErrInvalidQuery):
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, repository.ErrQueueFull):
+		// El productor debe bajar el ritmo en vez de seguir llenando MongoDB
+		writer.Header().Set("Retry-After", queueFullRetryAfter)
+		http.Error(writer, err.Error(), http.StatusTooManyRequests)
+	default:
+		http.Error(writer, "Error interno", http.StatusInternalServerError)
+	}
+}
+
+// writeJSON escribe una respuesta JSON con el status indicado
+func writeJSON(writer http.ResponseWriter, status int, value interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	json.NewEncoder(writer).Encode(value)
+}
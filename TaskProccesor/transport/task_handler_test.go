@@ -0,0 +1,42 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"taskProcessor/repository"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestSearchTasksBadRequest(t *testing.T) {
+	// Sin servidor: todas estas búsquedas se rechazan antes de consultar MongoDB
+	client, err := mongo.Connect(context.Background(), options.Client().
+		ApplyURI("mongodb://127.0.0.1:1").
+		SetServerSelectionTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect(context.Background())
+	handler := NewTaskHandler(repository.NewTaskRepository(client.Database("offline").Collection("tasks")))
+
+	for _, query := range []string{
+		"cursor=no-es-un-cursor",
+		"status=terminada",
+		"sort=payload",
+		"created_after=ayer",
+		"min_attempts=dos",
+		"limit=0",
+	} {
+		t.Run(query, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			handler.HandleSearchTasks(recorder, httptest.NewRequest(http.MethodGet, "/tasks?"+query, nil))
+			if recorder.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, se esperaba 400: %s", recorder.Code, recorder.Body.String())
+			}
+		})
+	}
+}
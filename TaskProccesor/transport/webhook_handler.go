@@ -0,0 +1,36 @@
+package transport
+
+import (
+	"net/http"
+	"taskProcessor/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// WebhookHandler endpoints de las entregas de webhooks
+type WebhookHandler struct {
+	deliveries *repository.WebhookRepository
+}
+
+func NewWebhookHandler(deliveries *repository.WebhookRepository) *WebhookHandler {
+	return &WebhookHandler{
+		deliveries: deliveries,
+	}
+}
+
+// HandleListDeliveries GET /tasks/{id}/webhooks
+// Intentos de entrega del webhook de la tarea, del más nuevo al más viejo
+func (handler *WebhookHandler) HandleListDeliveries(writer http.ResponseWriter, request *http.Request) {
+	id, err := primitive.ObjectIDFromHex(request.PathValue("id"))
+	if err != nil {
+		http.Error(writer, "ID de tarea inválido", http.StatusBadRequest)
+		return
+	}
+
+	deliveries, err := handler.deliveries.ListByTask(request.Context(), id, 100)
+	if err != nil {
+		http.Error(writer, "Error al listar entregas de webhook", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(writer, http.StatusOK, deliveries)
+}
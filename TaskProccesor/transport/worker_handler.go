@@ -0,0 +1,28 @@
+package transport
+
+import (
+	"net/http"
+	"taskProcessor/repository"
+)
+
+// WorkerHandler endpoints del registro de workers
+type WorkerHandler struct {
+	repo *repository.WorkerRepository
+}
+
+func NewWorkerHandler(repo *repository.WorkerRepository) *WorkerHandler {
+	return &WorkerHandler{
+		repo: repo,
+	}
+}
+
+// HandleListWorkers GET /workers
+// Lista los pools vivos y las tareas que está ejecutando cada uno.
+func (handler *WorkerHandler) HandleListWorkers(writer http.ResponseWriter, request *http.Request) {
+	workers, err := handler.repo.List(request.Context())
+	if err != nil {
+		http.Error(writer, "Error al obtener los workers", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(writer, http.StatusOK, workers)
+}